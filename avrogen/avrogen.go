@@ -3,7 +3,10 @@ package avrogen
 import (
 	"encoding/binary"
 	"fmt"
-	"math/rand"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 
 	c "github.com/andrewinci/rap/configuration"
@@ -14,192 +17,583 @@ type avroGen struct {
 	schema         avro.Schema
 	schemaId       int
 	generatorsRepo map[string]fieldGen
-	randomSource   *rand.Rand
+	state          *generatorState
+	maxDepth       int
+	profile        c.GenerationProfile
+	// paths targeted by a rule, including
+	// the paths of the parent fields
+	ruledPaths map[string]bool
+	// paths of the fields referenced by the rule
+	// at the path used as key
+	dependencies map[string][]string
+	// rules that pick the generator accordingly
+	// to the values of other fields
+	conditionalRules map[string][]ruleBranch
+	pools            *ValuePools
+	// name of the pool where to publish the
+	// value generated at the path used as key
+	published map[string]string
+	// probability of null for the optional unions,
+	// nil to pick the types of the union uniformly
+	nullProbability   *float64
+	nullProbabilities map[string]float64
+	// true if the generators depend on the previous records,
+	// e.g. sequence_by_key(), hence the records can only be
+	// generated in order
+	sequential bool
+	// index of the next record returned by Generate
+	next *int64
+	plan *generationPlan
 }
 
+// max number of nested references to a record
+// used when not specified in the configuration
+const defaultMaxDepth = 3
+
 type AvroGen interface {
 	// return the avro record value and the key
+	// of the record following the last generated one
 	Generate() ([]byte, string, error)
+	// return the avro record value and the key of the record
+	// at the index. The same seed and index always generate the
+	// same record, unless the generator is sequential
+	GenerateAt(index int64) ([]byte, string, error)
+	// true if the records can only be generated in order
+	// because the generators depend on the previous records
+	IsSequential() bool
 	generate(schema avro.Schema, fieldPath string) (interface{}, error)
 	getSchema() avro.Schema
+	// stop publishing into the value pools
+	Close()
 }
 
 func NewAvroGen(config c.AvroGenConfiguration, seed int64) (AvroGen, error) {
+	return NewAvroGenWithPools(config, seed, nil)
+}
+
+// create a generator that can publish and draw values from the pools
+// shared with the generators of other producers
+func NewAvroGenWithPools(config c.AvroGenConfiguration, seed int64, pools *ValuePools) (AvroGen, error) {
 	// parse avro schema
 	schema, err := avro.Parse(config.Schema.Raw)
 	if err != nil {
 		return nil, err
 	}
-	randomSource := rand.New(rand.NewSource(seed))
+	state := newGeneratorState(seed)
+	state.clock, err = newClock(config.Clock)
+	if err != nil {
+		return nil, err
+	}
+	if config.Locale != "" {
+		state.locale, err = getFakeLocale(config.Locale)
+		if err != nil {
+			return nil, err
+		}
+	}
 	generatorsRepo := map[string]fieldGen{
-		"key":                defaultKeyGen(randomSource),
-		string(avro.Boolean): defaultBooleanFieldGen(randomSource),
-		string(avro.Int):     defaultIntFieldGen(randomSource),
-		string(avro.Long):    defaultLongFieldGen(randomSource),
-		string(avro.Float):   defaultFloatFieldGen(randomSource),
-		string(avro.Double):  defaultDoubleFieldGen(randomSource),
-		string(avro.String):  defaultStringFieldGen(randomSource),
+		"key":                defaultKeyGen(state),
+		string(avro.Boolean): defaultBooleanFieldGen(state),
+		string(avro.Int):     defaultIntFieldGen(state),
+		string(avro.Long):    defaultLongFieldGen(state),
+		string(avro.Float):   defaultFloatFieldGen(state),
+		string(avro.Double):  defaultDoubleFieldGen(state),
+		string(avro.String):  defaultStringFieldGen(state),
+		string(avro.Bytes):   defaultBytesFieldGen(state),
 		string(avro.Null):    defaultNullFieldGen(),
+		// logical types
+		string(avro.Date):            defaultDateFieldGen(state),
+		string(avro.TimeMillis):      defaultTimeMillisFieldGen(state),
+		string(avro.TimeMicros):      defaultTimeMicrosFieldGen(state),
+		string(avro.TimestampMillis): defaultTimestampFieldGen(state),
+		string(avro.TimestampMicros): defaultTimestampFieldGen(state),
+		string(avro.UUID):            defaultUUIDFieldGen(state),
 	}
 
 	fieldGenerators := map[string]fieldGen{}
+	generatorReferences := map[string][]string{}
+	// collect all the problems of the configuration
+	// to report them at once
+	var problems []string
 
+	for k, l := range config.GeneratorLocales {
+		if _, ok := config.Generators[k]; !ok {
+			problems = append(problems, fmt.Sprintf("locale %s configured for the missing generator %s", l, k))
+		}
+	}
+
+	publishedPools := map[string]bool{}
+	for k, v := range config.Publish {
+		if pools == nil {
+			return nil, fmt.Errorf("value pools not available to publish the field %s", k)
+		}
+		publishedPools[v] = true
+	}
+
+	sequential := false
 	for k, v := range config.Generators {
-		fieldGen := newFieldGen(v, randomSource)
-		fieldGenerators[k] = func() (interface{}, error) {
-			res, err := fieldGen()
-			return res, err
+		// the sequences by key depend on the previous records
+		if usesFunction(v, "sequence_by_key") {
+			sequential = true
+			// the state is kept for each key, hence the
+			// keys need to come from a few distinct values
+			if _, ok := config.GenerationRules["key"]; !ok {
+				problems = append(problems, fmt.Sprintf("the generator %s uses sequence_by_key() but the record key is not generated by a `key` rule, the default keys are unique", k))
+			}
+		}
+		generatorState := state
+		if l, ok := config.GeneratorLocales[k]; ok {
+			locale, err := getFakeLocale(l)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("invalid locale of the generator %s, %s", k, err.Error()))
+				continue
+			}
+			generatorState = state.withLocale(locale)
+		}
+		poolGen, isPool, err := newPoolFieldGen(v, generatorState, pools, publishedPools)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid generator %s, %s", k, err.Error()))
+			continue
+		}
+		if isPool {
+			fieldGenerators[k] = poolGen
+			continue
 		}
+		derivedGen, isDerived, err := newDerivedFieldGen(v, generatorState)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid generator %s, %s", k, err.Error()))
+			continue
+		}
+		if isDerived {
+			fieldGenerators[k] = derivedGen.gen
+			generatorReferences[k] = derivedGen.references
+			continue
+		}
+		fieldGen, err := newFieldGen(v, generatorState)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("invalid pattern %s of the generator %s, %s", v, k, err.Error()))
+			continue
+		}
+		fieldGenerators[k] = fieldGen
 	}
 
+	ruledPaths := map[string]bool{}
+	dependencies := map[string][]string{}
+	conditionalRules := map[string][]ruleBranch{}
+	rules := map[string][]ruleBranch{}
 	for k, v := range config.GenerationRules {
-		g, ok := fieldGenerators[v]
-		if !ok {
-			return nil, fmt.Errorf("missing generator %s for the rule %s", v, k)
+		var branches []ruleBranch
+		if _, ok := config.Generators[v]; !ok && strings.HasSuffix(k, ".union()") {
+			// the union rules accept the list of types in place of a generator
+			unionGen, err := newFieldGen(unionTypesPattern(v), state)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("invalid list of types %s for the rule %s", v, k))
+				continue
+			}
+			branches = []ruleBranch{{target: v, gen: unionGen}}
+		} else {
+			branches, err = parseRule(v)
+			if err != nil {
+				problems = append(problems, fmt.Sprintf("invalid rule %s, %s", k, err.Error()))
+				continue
+			}
 		}
-		generatorsRepo[k] = g
+		var references []string
+		valid := true
+		for i, b := range branches {
+			if b.condition != nil {
+				references = append(references, b.condition.path)
+			}
+			if b.gen != nil {
+				continue
+			}
+			g, ok := fieldGenerators[b.target]
+			_, configured := config.Generators[b.target]
+			switch {
+			case !configured && b.target != nullTarget && b.target != notNullTarget:
+				problems = append(problems, fmt.Sprintf("missing generator %s for the rule %s", b.target, k))
+				valid = false
+			case configured && !ok:
+				// the generator is invalid, the problem is already reported
+				valid = false
+			}
+			branches[i].gen = g
+			references = append(references, generatorReferences[b.target]...)
+		}
+		if !valid {
+			continue
+		}
+		if len(branches) == 1 && branches[0].condition == nil && branches[0].gen != nil {
+			generatorsRepo[k] = branches[0].gen
+		} else if strings.HasPrefix(k, ".") {
+			conditionalRules[k] = branches
+		} else {
+			problems = append(problems, fmt.Sprintf("invalid rule %s, conditions are only supported for field paths", k))
+			continue
+		}
+		rules[k] = branches
+		for _, r := range references {
+			if isSubPath(r, k) || isSubPath(k, r) {
+				problems = append(problems, fmt.Sprintf("the rule %s references the field itself or one of its parents", k))
+				break
+			}
+		}
+		if len(references) > 0 {
+			dependencies[k] = references
+		}
+		// keep track of the paths with a rule and their parents
+		if strings.HasPrefix(k, ".") {
+			segments := strings.Split(k[1:], ".")
+			for i := range segments {
+				ruledPaths["."+strings.Join(segments[:i+1], ".")] = true
+			}
+		}
+	}
+
+	maxDepth := config.MaxDepth
+	if maxDepth == 0 {
+		maxDepth = defaultMaxDepth
 	}
 
-	return avroGen{
-		schema:         schema,
-		schemaId:       config.Schema.Id,
-		generatorsRepo: generatorsRepo,
-		randomSource:   randomSource,
-	}, nil
+	// validate the configuration against the schema
+	problems = append(problems, validateConfiguration(schema, config, rules, generatorReferences)...)
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return nil, fmt.Errorf("invalid configuration:\n - %s", strings.Join(problems, "\n - "))
+	}
+
+	gen := avroGen{
+		schema:            schema,
+		schemaId:          config.Schema.Id,
+		generatorsRepo:    generatorsRepo,
+		state:             state,
+		maxDepth:          maxDepth,
+		profile:           config.Profile,
+		ruledPaths:        ruledPaths,
+		dependencies:      dependencies,
+		conditionalRules:  conditionalRules,
+		pools:             pools,
+		published:         config.Publish,
+		nullProbability:   config.NullProbability,
+		nullProbabilities: config.NullProbabilities,
+		sequential:        sequential,
+		next:              new(int64),
+		plan: &generationPlan{
+			encoders: newEncoderCompiler(),
+			values:   len(dependencies) > 0 || len(conditionalRules) > 0 || len(generatorReferences) > 0 || len(config.Publish) > 0,
+		},
+	}
+	// the recursive schemas are compiled lazily, check
+	// the plan to report its errors before generating
+	if err := gen.checkPlan(schema, "", 0, map[string]bool{}); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n - %s", err.Error())
+	}
+	gen.plan.root = gen.compileNested(schema, "", 0)
+
+	// register the publishers only once the generator is valid
+	for _, v := range config.Publish {
+		pools.register(v)
+	}
+
+	return gen, nil
 }
 
 func (g avroGen) getSchema() avro.Schema {
 	return g.schema
 }
 
+func (g avroGen) IsSequential() bool {
+	return g.sequential
+}
+
 func (g avroGen) Generate() ([]byte, string, error) {
-	generated, err := g.generate(g.schema, "")
-	if err != nil {
-		return nil, "", err
+	return g.GenerateAt(*g.next)
+}
+
+func (g avroGen) GenerateAt(index int64) ([]byte, string, error) {
+	if g.sequential && index != *g.next {
+		return nil, "", fmt.Errorf("the record %d cannot be generated before the record %d, the generators depend on the previous records", index, *g.next)
 	}
+	*g.next = index + 1
+	g.state.startRecord(index)
+	// the key is generated first to make it available
+	// to the generators of the record value
 	key, err := g.generatorsRepo["key"]()
 	if err != nil {
 		return nil, "", fmt.Errorf("unable to generate the key, %s", err.Error())
 	}
-	raw, err := avro.Marshal(g.schema, generated)
+	g.state.record.key = key.(string)
+	// header with the magic byte and the schema id
+	buf := append(g.plan.buf[:0], 0x00, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(buf[1:], uint32(g.schemaId))
+	buf, generated, err := g.plan.root(buf)
+	g.plan.buf = buf
 	if err != nil {
-		return nil, "", fmt.Errorf("unable to marshal the record, %s", err.Error())
+		return nil, "", err
 	}
-	bs := make([]byte, 4)
-	binary.BigEndian.PutUint32(bs, uint32(g.schemaId))
-	msg := append([]byte{0x00}, bs...)
-	msg = append(msg, raw...)
-	return msg, key.(string), err
+	for path, pool := range g.published {
+		if path == "key" {
+			g.pools.publish(pool, key.(string))
+			continue
+		}
+		value, err := lookup(generated.(map[string]interface{}), path)
+		if err == nil && value != nil {
+			g.pools.publish(pool, toPoolValue(value))
+		}
+	}
+	// the buffer is reused by the next record
+	msg := make([]byte, len(buf))
+	copy(msg, buf)
+	return msg, key.(string), nil
 }
 
 func (g avroGen) generate(schema avro.Schema, fieldPath string) (interface{}, error) {
-	if schema.Type() == avro.Record {
-		recordSchema := schema.(*avro.RecordSchema)
-		return g.generateRecord(recordSchema, fieldPath)
-	}
-	if schema.Type() == avro.Array {
-		return g.generateRandomArray(schema.(*avro.ArraySchema), fieldPath)
+	// the values are always built when requested
+	values := g.plan.values
+	g.plan.values = true
+	defer func() { g.plan.values = values }()
+	node := g.plan.root
+	if schema != g.schema || fieldPath != "" {
+		node = g.compileNested(schema, fieldPath, 0)
 	}
-	fieldGen, ok := g.generatorsRepo[fieldPath]
-	if ok {
-		return fieldGen()
+	_, res, err := node(nil)
+	return res, err
+}
+
+func (g avroGen) Close() {
+	for _, pool := range g.published {
+		g.pools.unregister(pool)
 	}
-	typeGen, ok := g.generatorsRepo[string(schema.Type())]
-	if ok {
-		return typeGen()
+}
+
+// sort the fields of the record so that the fields referenced
+// by a derived field are generated before the latter
+func (g avroGen) sortFields(schema *avro.RecordSchema, fieldPath string) ([]*avro.Field, error) {
+	if len(g.dependencies) == 0 {
+		return schema.Fields(), nil
 	}
-	// no customization found for the union field, pick a random type in the union
-	if schema.Type() == avro.Union {
-		return g.generateUnionField(schema.(*avro.UnionSchema), fieldPath)
+	// find the siblings each field depends on
+	fields := schema.Fields()
+	dependsOn := make([]map[int]bool, len(fields))
+	for i, f := range fields {
+		dependsOn[i] = map[int]bool{}
+		path := fieldPath + "." + f.Name()
+		for rulePath, references := range g.dependencies {
+			if !isSubPath(rulePath, path) {
+				continue
+			}
+			for _, r := range references {
+				for j, s := range fields {
+					if i != j && isSubPath(r, fieldPath+"."+s.Name()) {
+						dependsOn[i][j] = true
+					}
+				}
+			}
+		}
 	}
-	// no customization found for the enum field, pick a random symbol
-	if schema.Type() == avro.Enum {
-		return g.generateRandomEnum(schema.(*avro.EnumSchema))
+	// topological sort that keeps the schema order
+	// when there are no dependencies
+	var res []*avro.Field
+	done := make([]bool, len(fields))
+	for len(res) < len(fields) {
+		progress := false
+		for i, f := range fields {
+			if done[i] {
+				continue
+			}
+			ready := true
+			for j := range dependsOn[i] {
+				ready = ready && done[j]
+			}
+			if ready {
+				res = append(res, f)
+				done[i] = true
+				progress = true
+			}
+		}
+		if !progress {
+			var cycle []string
+			for i, f := range fields {
+				if !done[i] {
+					cycle = append(cycle, fieldPath+"."+f.Name())
+				}
+			}
+			return nil, fmt.Errorf("cyclic dependency between the fields %s", strings.Join(cycle, ", "))
+		}
 	}
+	return res, nil
+}
 
-	return nil, fmt.Errorf("no generator found for type %s, path %s", string(schema.Type()), fieldPath)
+// return true if the path is equal to the parent
+// path or is the path of a nested field
+func isSubPath(path string, parent string) bool {
+	return path == parent || strings.HasPrefix(path, parent+".")
 }
 
-func (g avroGen) generateRecord(schema *avro.RecordSchema, fieldPath string) (map[string]interface{}, error) {
-	res := map[string]interface{}{}
-	for _, f := range schema.Fields() {
-		val, err := g.generate(f.Type(), fieldPath+"."+f.Name())
+// convert the default value parsed from the schema
+// into a value that can be marshalled
+func convertDefault(schema avro.Schema, value interface{}) (interface{}, error) {
+	schema = derefSchema(schema)
+	switch schema.Type() {
+	case avro.Bytes:
+		return defaultBytes(value.(string))
+	case avro.Fixed:
+		b, err := defaultBytes(value.(string))
 		if err != nil {
 			return nil, err
 		}
-		res[f.Name()] = val
+		return toFixed(b, schema.(*avro.FixedSchema))
+	case avro.Union:
+		// the default of a union is always of the first type
+		typeOption := schema.(*avro.UnionSchema).Types()[0]
+		res, err := convertDefault(typeOption, value)
+		if name, ok := unionTypeName(typeOption); ok {
+			return map[string]interface{}{name: res}, err
+		}
+		return res, err
+	case avro.Array:
+		res := []interface{}{}
+		for _, v := range value.([]interface{}) {
+			item, err := convertDefault(schema.(*avro.ArraySchema).Items(), v)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, item)
+		}
+		return res, nil
+	case avro.Map:
+		res := map[string]interface{}{}
+		for k, v := range value.(map[string]interface{}) {
+			item, err := convertDefault(schema.(*avro.MapSchema).Values(), v)
+			if err != nil {
+				return nil, err
+			}
+			res[k] = item
+		}
+		return res, nil
+	case avro.Record:
+		res := map[string]interface{}{}
+		for _, f := range schema.(*avro.RecordSchema).Fields() {
+			item, err := convertDefault(f.Type(), value.(map[string]interface{})[f.Name()])
+			if err != nil {
+				return nil, err
+			}
+			res[f.Name()] = item
+		}
+		return res, nil
+	}
+	return value, nil
+}
+
+// convert the default of bytes and fixed, where each
+// code point from 0 to 255 is one byte as in the avro spec
+func defaultBytes(value string) ([]byte, error) {
+	res := make([]byte, 0, len(value))
+	for _, r := range value {
+		if r > 255 {
+			return nil, fmt.Errorf("invalid default %q, the code points of the bytes must be between 0 and 255", value)
+		}
+		res = append(res, byte(r))
 	}
 	return res, nil
 }
 
-func (g avroGen) generateUnionField(schema *avro.UnionSchema, fieldPath string) (interface{}, error) {
+var weightRegex = regexp.MustCompile(`^(.+):\s*([-+]?[0-9]*\.?[0-9]+)$`)
 
-	// check if there is a generator for the object
-	// nested in the union
-	unionValue := ""
-	for k := range g.generatorsRepo {
-		if len(k) > len(fieldPath) && k[0:len(fieldPath)] == fieldPath {
-			// +1 for the trailing .
-			unionValue = strings.Split(k[len(fieldPath)+1:], ".")[0]
-			break
-		}
+// split a type of the union rules like `Type:weight`
+// into the name and the weight of the type
+func parseWeight(s string) (string, float64, bool) {
+	matches := weightRegex.FindStringSubmatch(s)
+	if matches == nil {
+		return s, 0, false
 	}
-	tIndex := 0
-	if unionValue == "" {
-		// pick a random type among the union options
-		tIndex = g.randomSource.Intn(len(schema.Types()))
-	} else {
-		for i, s := range schema.Types() {
-			if s.Type() == avro.Record && s.(*avro.RecordSchema).Name() == unionValue {
-				tIndex = i
-				break
-			}
-		}
-		fieldPath += "." + unionValue
+	weight, err := strconv.ParseFloat(matches[2], 64)
+	if err != nil {
+		return s, 0, false
 	}
+	return strings.Trim(matches[1], " "), weight, true
+}
 
-	typeOption := schema.Types()[tIndex]
-	res, err := g.generate(typeOption, fieldPath)
-	// wrap the result into a map with key the type name
-	// same as the avro json syntax
-	if typeOption.Type() == avro.Record {
-		return map[string]interface{}{
-			typeOption.(*avro.RecordSchema).Name(): res,
-		}, err
-	} else if typeOption.Type() == avro.Enum {
-		return map[string]interface{}{
-			typeOption.(*avro.EnumSchema).Name(): res,
-		}, err
-	} else {
-		return res, err
+// convert the list of types of a union rule like `Card:70|Cash:30`
+// into the pattern of a generator that picks one of the types
+func unionTypesPattern(rawTypes string) string {
+	var names, weights []string
+	weighted := false
+	for _, t := range strings.Split(rawTypes, "|") {
+		name, weight, ok := parseWeight(strings.Trim(t, " "))
+		weighted = weighted || ok
+		names = append(names, name)
+		weights = append(weights, strconv.FormatFloat(weight, 'f', -1, 64))
 	}
+	res := fmt.Sprintf("{string}[%s]{1}", strings.Join(names, "|"))
+	if weighted {
+		// the types without a weight are reported as invalid
+		res += "<" + strings.Join(weights, "|") + ">"
+	}
+	return res
 }
 
-func (g avroGen) generateRandomEnum(schema *avro.EnumSchema) (interface{}, error) {
-	symbolIndex := g.randomSource.Intn(len(schema.Symbols()))
-	return schema.Symbols()[symbolIndex], nil
+// return the names that identify the type of a union in the rules:
+// name and full name for the named types, the type otherwise
+func unionTypeNames(schema avro.Schema) []string {
+	schema = derefSchema(schema)
+	if named, ok := schema.(avro.NamedSchema); ok {
+		return []string{named.Name(), named.FullName()}
+	}
+	if name, ok := unionTypeName(schema); ok {
+		return []string{name, string(schema.Type())}
+	}
+	return []string{string(schema.Type())}
 }
 
-func (g avroGen) generateRandomArray(schema *avro.ArraySchema, fieldPath string) (interface{}, error) {
-	// check if a len generator is specified
-	randomLen := g.randomSource.Intn(10)
-	gen, ok := g.generatorsRepo[fieldPath+".len()"]
-	if ok {
-		tmp, err := gen()
-		if err != nil {
-			return nil, err
-		}
-		// todo: make sure the len() gen is int
-		randomLen = tmp.(int)
+// return the name used to identify the schema in a union.
+// Primitive types without logical type don't need to be wrapped.
+func unionTypeName(schema avro.Schema) (string, bool) {
+	schema = derefSchema(schema)
+	if namedSchema, ok := schema.(avro.NamedSchema); ok {
+		return namedSchema.FullName(), true
+	}
+	if logicalType := getLogicalType(schema); logicalType != "" {
+		// logical types are identified by the underlying type
+		// and the logical type name, e.g. long.timestamp-millis
+		return string(schema.Type()) + "." + string(logicalType), true
 	}
+	if schema.Type() == avro.Array || schema.Type() == avro.Map {
+		return string(schema.Type()), true
+	}
+	return "", false
+}
 
-	var array []interface{}
-	for i := 0; i < randomLen; i++ {
-		res, err := g.generate(schema.Items(), fieldPath)
-		if err != nil {
-			return nil, err
+func (g avroGen) generateRandomDecimal(schema *avro.DecimalLogicalSchema) (interface{}, error) {
+	// the unscaled value can have at most `precision` digits
+	max := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(schema.Precision())), nil)
+	unscaled := new(big.Int).Rand(g.state.random, max)
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(schema.Scale())), nil)
+	return new(big.Rat).SetFrac(unscaled, scale), nil
+}
+
+// return true if null is one of the types of the union
+func isNullable(schema *avro.UnionSchema) bool {
+	for _, t := range schema.Types() {
+		if t.Type() == avro.Null {
+			return true
 		}
-		array = append(array, res)
 	}
-	return array, nil
+	return false
+}
+
+// return the schema referenced if the schema is a reference
+func derefSchema(schema avro.Schema) avro.Schema {
+	if schema.Type() == avro.Ref {
+		return schema.(*avro.RefSchema).Schema()
+	}
+	return schema
+}
+
+// return the logical type of the schema if any
+func getLogicalType(schema avro.Schema) avro.LogicalType {
+	logicalSchema, ok := schema.(avro.LogicalTypeSchema)
+	if !ok || logicalSchema.Logical() == nil {
+		return ""
+	}
+	return logicalSchema.Logical().Type()
 }
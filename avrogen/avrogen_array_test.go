@@ -137,7 +137,7 @@ func TestHappyPathAvroGenArray(t *testing.T) {
 	}
 	generatedArray := res.(map[string]interface{})["testField"].([]interface{})
 
-	if generatedArray[0].(string) != "Bhz8K9EN0P" {
+	if generatedArray[0].(string) != "2Vr0ODn4o9" {
 		t.FailNow()
 	}
 	_, _, err = sut.Generate()
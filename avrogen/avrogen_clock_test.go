@@ -0,0 +1,103 @@
+package avrogen
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/andrewinci/rap/configuration"
+	"github.com/hamba/avro"
+)
+
+const eventsTestSchema = `
+{
+	"type": "record",
+	"name": "Event",
+	"fields": [
+		{ "name": "id", "type": { "type": "string", "logicalType": "uuid" } },
+		{ "name": "at", "type": { "type": "long", "logicalType": "timestamp-millis" } },
+		{ "name": "sentAt", "type": "string" }
+	]
+}`
+
+func eventsTestConfig() configuration.AvroGenConfiguration {
+	return configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{Raw: eventsTestSchema},
+		GenerationRules: map[string]string{
+			".sentAt": "sentAtGen",
+		},
+		Generators: map[string]string{
+			"sentAtGen": "{string}[timestamp_ms()]{1}",
+		},
+		Clock: configuration.ClockConfiguration{Start: "2022-01-01T00:00:00Z", Step: "100ms"},
+	}
+}
+
+func TestReproducibleGeneration(t *testing.T) {
+	generate := func(seed int64) [][]byte {
+		gen, err := NewAvroGen(eventsTestConfig(), seed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res [][]byte
+		for i := 0; i < 10; i++ {
+			msg, key, err := gen.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, append([]byte(key), msg...))
+		}
+		return res
+	}
+	first, second, other := generate(1), generate(1), generate(2)
+	for i := range first {
+		if !bytes.Equal(first[i], second[i]) {
+			t.Errorf("the record %d should be identical with the same seed", i)
+		}
+		if bytes.Equal(first[i], other[i]) {
+			t.Errorf("the record %d should be different with a different seed", i)
+		}
+	}
+}
+
+func TestSimulatedClock(t *testing.T) {
+	gen, err := NewAvroGen(eventsTestConfig(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		msg, _, err := gen.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		record := map[string]interface{}{}
+		if err := avro.Unmarshal(gen.getSchema(), msg[5:], &record); err != nil {
+			t.Fatal(err)
+		}
+		expected := start.Add(time.Duration(i) * 100 * time.Millisecond).UnixMilli()
+		if record["sentAt"] != fmt.Sprint(expected) {
+			t.Errorf("expected the simulated time %d, got %v", expected, record["sentAt"])
+		}
+		at := record["at"].(time.Time)
+		if at.After(start.Add(time.Second)) || at.Before(start.Add(-defaultTimeWindow)) {
+			t.Errorf("the timestamp %s should be in the window before the simulated time", at)
+		}
+	}
+}
+
+func TestInvalidClock(t *testing.T) {
+	for _, clock := range []configuration.ClockConfiguration{
+		{Start: "2022-01-01"},
+		{Start: "2022-01-01T00:00:00Z", Step: "-1s"},
+		{Start: "2022-01-01T00:00:00Z", Step: "1x"},
+		{Step: "1s"},
+	} {
+		config := eventsTestConfig()
+		config.Clock = clock
+		if _, err := NewAvroGen(config, 0); err == nil {
+			t.Errorf("the clock %v should be invalid", clock)
+		}
+	}
+}
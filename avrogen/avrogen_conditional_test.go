@@ -0,0 +1,169 @@
+package avrogen
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+const conditionalTestSchema = `
+{
+	"type": "record",
+	"name": "Transaction",
+	"fields": [
+		{ "name": "amount", "type": "double" },
+		{ "name": "closedAt", "type": ["null", { "type": "long", "logicalType": "timestamp-millis" }] },
+		{ "name": "type", "type": { "type": "enum", "name": "Type", "symbols": ["PAYMENT", "REFUND", "VOID"] } },
+		{ "name": "status", "type": ["null", { "type": "enum", "name": "Status", "symbols": ["OPEN", "CLOSED"] }] },
+		{ "name": "note", "type": ["null", "string"] }
+	]
+}`
+
+func TestHappyAvroGenConditionalRules(t *testing.T) {
+	sut, err := newTestAvroGen(conditionalTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".amount":   "negativeAmountGen if .type == REFUND else zeroGen if .type == VOID else positiveAmountGen",
+			".closedAt": "not_null if .status == CLOSED else null",
+			".note":     "noteGen if .status != OPEN|null",
+		},
+		Generators: map[string]string{
+			"negativeAmountGen": "{double}[range(-100,-1)]{1}",
+			"positiveAmountGen": "{double}[range(1,100)]{1}",
+			"zeroGen":           "{double}[0]{1}",
+			"noteGen":           "{string}[closed]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})
+		amount := res["amount"].(float64)
+		switch res["type"] {
+		case "REFUND":
+			if amount >= 0 {
+				t.Errorf("expected a negative amount for a refund, got %f", amount)
+			}
+		case "VOID":
+			if amount != 0 {
+				t.Errorf("expected a zero amount for a void, got %f", amount)
+			}
+		default:
+			if amount <= 0 {
+				t.Errorf("expected a positive amount for a payment, got %f", amount)
+			}
+		}
+		closed := res["status"] != nil && res["status"].(map[string]interface{})["Status"] == "CLOSED"
+		if closed != (res["closedAt"] != nil) {
+			t.Errorf("closedAt should be set only for the closed status, got %v", res)
+		}
+		if closed {
+			if _, ok := res["closedAt"].(map[string]interface{})["long.timestamp-millis"].(time.Time); !ok {
+				t.Errorf("expected a timestamp, got %v", res["closedAt"])
+			}
+		}
+		if closed != (res["note"] == "closed") {
+			t.Errorf("unexpected note %v", res)
+		}
+	}
+	if _, _, err := sut.Generate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAvroGenConditionalRulesInvalid(t *testing.T) {
+	invalidRules := []map[string]string{
+		{".amount": "missingGen if .type == REFUND else zeroGen"},
+		{".amount": "zeroGen else positiveAmountGen"},
+		{".amount": "zeroGen if .type REFUND"},
+		{".amount": "zeroGen if .amount == 0"},
+		{"double": "zeroGen if .type == REFUND"},
+	}
+	for _, r := range invalidRules {
+		_, err := newTestAvroGen(conditionalTestSchema, configuration.AvroGenConfiguration{
+			GenerationRules: r,
+			Generators: map[string]string{
+				"positiveAmountGen": "{double}[range(1,100)]{1}",
+				"zeroGen":           "{double}[0]{1}",
+			}}, 0)
+		if err == nil {
+			t.Errorf("expected an error for the rule %v", r)
+		}
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	branches, err := parseRule("gen1 if .a.b == X | Y else gen2 if .c != null else gen3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(branches) != 3 || branches[2].condition != nil || branches[2].target != "gen3" {
+		t.Fatalf("unexpected branches %v", branches)
+	}
+	c := branches[0].condition
+	if branches[0].target != "gen1" || c.path != ".a.b" || c.negate || len(c.values) != 2 || c.values[1] != "Y" {
+		t.Errorf("unexpected first branch %v", branches[0])
+	}
+	if !branches[1].condition.negate || branches[1].condition.values[0] != "null" {
+		t.Errorf("unexpected second branch %v", branches[1])
+	}
+	view := map[string]interface{}{"a": map[string]interface{}{"b": "Y"}, "c": nil}
+	if b, ok := pickBranch(branches, view); !ok || b.target != "gen1" {
+		t.Errorf("expected the first branch")
+	}
+	view["a"] = map[string]interface{}{"b": "Z"}
+	if b, ok := pickBranch(branches, view); !ok || b.target != "gen3" {
+		t.Errorf("expected the last branch")
+	}
+}
+
+func TestAvroGenConditionalRuleOnOptionalRecord(t *testing.T) {
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{Raw: `
+		{
+			"type": "record",
+			"name": "Order",
+			"fields": [
+				{ "name": "customer", "type": ["null", {
+					"type": "record",
+					"name": "Customer",
+					"fields": [{ "name": "kind", "type": { "type": "enum", "name": "Kind", "symbols": ["A", "B"] } }]
+				}] },
+				{ "name": "x", "type": ["null", "string"] }
+			]
+		}`},
+		GenerationRules: map[string]string{
+			".x": "null if .customer.kind == A else xGen",
+		},
+		Generators: map[string]string{
+			"xGen": "{string}[set]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kindA := 0
+	for i := 0; i < 100; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})
+		isA := false
+		if customer, ok := res["customer"].(map[string]interface{}); ok {
+			isA = customer["Customer"].(map[string]interface{})["kind"] == "A"
+		}
+		if isA {
+			kindA++
+		}
+		if isA != (res["x"] == nil) {
+			t.Errorf("x should be null only when the kind of the customer is A, got %v", res)
+		}
+	}
+	if kindA == 0 {
+		t.Error("expected some customers of kind A")
+	}
+}
@@ -0,0 +1,268 @@
+package avrogen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+const derivedTestSchema = `
+{
+	"type": "record",
+	"name": "Example",
+	"fields": [
+		{ "name": "total", "type": "double" },
+		{ "name": "price", "type": "double" },
+		{ "name": "qty", "type": "int" },
+		{ "name": "Email", "type": "string" },
+		{ "name": "Name", "type": "string" },
+		{
+			"name": "SubRecord",
+			"type": {
+				"type": "record",
+				"name": "Sub",
+				"fields": [
+					{ "name": "Contact", "type": "string" },
+					{ "name": "Code", "type": "int" }
+				]
+			}
+		}
+	]
+}`
+
+func TestHappyAvroGenDerivedFields(t *testing.T) {
+	sut, err := newTestAvroGen(derivedTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".total":             "totalGen",
+			".price":             "priceGen",
+			".qty":               "qtyGen",
+			".Email":             "emailGen",
+			".Name":              "nameGen",
+			".SubRecord.Contact": "contactGen",
+			".SubRecord.Code":    "codeGen",
+		},
+		Generators: map[string]string{
+			"totalGen":   "{double}expr(.price * .qty)",
+			"priceGen":   "{double}[range(1, 10)]{1}",
+			"qtyGen":     "{int}[range(1, 5)]{1}",
+			"emailGen":   "{string}template({{ lower .Name }}@example.com)",
+			"nameGen":    "{string}[John|Jane]{1}",
+			"contactGen": "{string}template({{ .Name }} <{{ .Email }}>)",
+			"codeGen":    "{int}expr(.qty * 10 + 1)",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})
+		if res["total"] != res["price"].(float64)*float64(res["qty"].(int)) {
+			t.Errorf("expected total = price * qty, got %v", res)
+		}
+		name := res["Name"].(string)
+		if res["Email"] != strings.ToLower(name)+"@example.com" {
+			t.Errorf("unexpected email %s", res["Email"])
+		}
+		sub := res["SubRecord"].(map[string]interface{})
+		if sub["Contact"] != name+" <"+res["Email"].(string)+">" {
+			t.Errorf("unexpected contact %s", sub["Contact"])
+		}
+		if sub["Code"] != res["qty"].(int)*10+1 {
+			t.Errorf("unexpected code %v", sub["Code"])
+		}
+	}
+	if _, _, err := sut.Generate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAvroGenDerivedFieldsSiblingInNestedRecord(t *testing.T) {
+	sut, err := newTestAvroGen(derivedTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".SubRecord.Contact": "contactGen",
+			".SubRecord.Code":    "codeGen",
+		},
+		Generators: map[string]string{
+			"contactGen": "{string}template(code-{{ .SubRecord.Code }})",
+			"codeGen":    "{int}[range(1, 9)]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawRes, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub := rawRes.(map[string]interface{})["SubRecord"].(map[string]interface{})
+	if sub["Contact"] != "code-"+string(rune('0'+sub["Code"].(int))) {
+		t.Errorf("unexpected contact %s", sub["Contact"])
+	}
+}
+
+func TestAvroGenDerivedFieldsCycle(t *testing.T) {
+	_, err := newTestAvroGen(derivedTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".price": "priceGen",
+			".qty":   "qtyGen",
+		},
+		Generators: map[string]string{
+			"priceGen": "{double}expr(.qty * 2)",
+			"qtyGen":   "{int}expr(.price / 2)",
+		}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "cyclic dependency between the fields .price, .qty") {
+		t.Errorf("expected a cyclic dependency error, got %v", err)
+	}
+	// the cycles between the fields of the nested records
+	// are reported when the generator is created as well
+	_, err = newTestAvroGen(derivedTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".SubRecord.Contact": "contactGen",
+			".SubRecord.Code":    "codeGen",
+		},
+		Generators: map[string]string{
+			"contactGen": "{string}template({{ .SubRecord.Code }})",
+			"codeGen":    "{int}expr(.SubRecord.Contact + 1)",
+		}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "cyclic dependency between the fields") {
+		t.Errorf("expected a cyclic dependency error from NewAvroGen, got %v", err)
+	}
+}
+
+func TestAvroGenDerivedFieldsInvalid(t *testing.T) {
+	invalidGenerators := []string{
+		"{double}expr(.price * )",
+		"{double}expr((.price * 2)",
+		"{double}expr(.price $ 2)",
+		"{boolean}expr(.price)",
+		"{string}template({{ .Name )",
+		"{int}expr(.total + 1)",
+	}
+	for _, g := range invalidGenerators {
+		_, err := newTestAvroGen(derivedTestSchema, configuration.AvroGenConfiguration{
+			GenerationRules: map[string]string{
+				".total": "gen",
+			},
+			Generators: map[string]string{
+				"gen": g,
+			}}, 0)
+		if err == nil {
+			t.Errorf("expected an error for the generator %s", g)
+		}
+	}
+	// a field can't reference itself or one of its parents
+	_, err := newTestAvroGen(derivedTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".SubRecord.Code": "gen",
+		},
+		Generators: map[string]string{
+			"gen": "{int}expr(.SubRecord + 1)",
+		}}, 0)
+	if err == nil {
+		t.Error("expected an error for a field referencing its parent")
+	}
+}
+
+func TestExpressionParser(t *testing.T) {
+	view := map[string]interface{}{"a": 7, "b": 2.5, "c": map[string]interface{}{"d": int64(3)}}
+	cases := map[string]interface{}{
+		"1 + 2 * 3":   int64(7),
+		"(1 + 2) * 3": int64(9),
+		".a / 2":      int64(3),
+		".a % 4":      int64(3),
+		".a * .b":     17.5,
+		"-.c.d + .a":  int64(4),
+		"10 - 2 - 3":  int64(5),
+		".a / 2.0":    3.5,
+		"2 * -(.c.d)": int64(-6),
+		" .a+.c.d ":   int64(10),
+	}
+	for input, expected := range cases {
+		p := expressionParser{input: input}
+		e, err := p.parse()
+		if err != nil {
+			t.Fatalf("unexpected error for %s: %s", input, err.Error())
+		}
+		res, err := e(view)
+		if err != nil || res != expected {
+			t.Errorf("expected %v for %s, got %v %v", expected, input, res, err)
+		}
+	}
+	p := expressionParser{input: ".a / 0"}
+	e, _ := p.parse()
+	if _, err := e(view); err == nil {
+		t.Error("expected a division by zero error")
+	}
+}
+
+func TestAvroGenDerivedFieldsInUnion(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Example",
+		"fields": [
+			{ "name": "customer", "type": ["null", {
+				"type": "record",
+				"name": "Customer",
+				"fields": [{ "name": "name", "type": "string" }]
+			}] },
+			{ "name": "greeting", "type": "string" }
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".customer":      "not_null",
+			".customer.name": "nameGen",
+			".greeting":      "greetingGen",
+		},
+		Generators: map[string]string{
+			"nameGen":     "{string}[John|Jane]{1}",
+			"greetingGen": "{string}template(Hi {{ .customer.name }}{{ if eq .customer.name \"Jane\" }}!{{ end }})",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})
+		name := res["customer"].(map[string]interface{})["Customer"].(map[string]interface{})["name"].(string)
+		expected := "Hi " + name
+		if name == "Jane" {
+			expected += "!"
+		}
+		if res["greeting"] != expected {
+			t.Errorf("expected %s, got %s", expected, res["greeting"])
+		}
+	}
+}
+
+func TestAvroGenDerivedFieldsUnsupportedTemplates(t *testing.T) {
+	for _, g := range []string{
+		"{string}template({{ range .Name }}x{{ end }})",
+		"{string}template({{ with .SubRecord }}{{ .Code }}{{ end }})",
+		"{string}template({{ $code := .SubRecord.Code }}{{ $code }})",
+		"{string}template({{ (.SubRecord).Code }})",
+		"{string}template({{ . }})",
+	} {
+		_, err := newTestAvroGen(derivedTestSchema, configuration.AvroGenConfiguration{
+			GenerationRules: map[string]string{
+				".Email": "gen",
+			},
+			Generators: map[string]string{
+				"gen": g,
+			}}, 0)
+		if err == nil {
+			t.Errorf("expected an error for the template %s", g)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package avrogen
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+func TestHappyPathAvroGenBytesAndFixed(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "bytesField", "type": "bytes" },
+			{ "name": "fixedField", "type": { "type": "fixed", "name": "Hash", "size": 16 } },
+			{ "name": "decimalField", "type": { "type": "fixed", "name": "Amount", "size": 8, "logicalType": "decimal", "precision": 10, "scale": 2 } },
+			{ "name": "unionField", "type": ["null", { "type": "fixed", "name": "Short", "size": 2 }] }
+		]
+	 }
+	`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	rawRes, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.FailNow()
+	}
+	res := rawRes.(map[string]interface{})
+	if len(res["bytesField"].([]byte)) == 0 {
+		t.Error("expected random bytes")
+	}
+	if _, ok := res["fixedField"].([16]byte); !ok {
+		t.Error("expected an array of 16 bytes")
+	}
+	if _, ok := res["decimalField"].(*big.Rat); !ok {
+		t.Error("expected a decimal")
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err = sut.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHappyPathAvroGenFixedRules(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "hash1", "type": { "type": "fixed", "name": "Hash", "namespace": "com.example", "size": 2 } },
+			{ "name": "hash2", "type": "com.example.Hash" },
+			{ "name": "other", "type": { "type": "fixed", "name": "Other", "size": 3 } }
+		]
+	 }
+	`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			"Hash":   "hashGen",
+			".other": "otherGen",
+		},
+		Generators: map[string]string{
+			"hashGen":  "{bytes}[hex(cafe)]{1}",
+			"otherGen": "{bytes}[base64(AQID)]{1}",
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	rawRes, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.FailNow()
+	}
+	res := rawRes.(map[string]interface{})
+	if res["hash1"] != [2]byte{0xca, 0xfe} || res["hash2"] != [2]byte{0xca, 0xfe} {
+		t.Error("the fixed name rule should be used for all the fields of that type")
+	}
+	if res["other"] != [3]byte{1, 2, 3} {
+		t.Error("the path rule should be used for the fixed field")
+	}
+	_, _, err = sut.Generate()
+	if err != nil {
+		t.FailNow()
+	}
+}
+
+func TestAvroGenFixedSizeMismatch(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "hash", "type": { "type": "fixed", "name": "Hash", "size": 4 } }
+		]
+	 }
+	`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".hash": "hashGen",
+		},
+		Generators: map[string]string{
+			"hashGen": "{bytes}[hex(cafe)]{1}",
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	_, _, err = sut.Generate()
+	if err == nil {
+		t.Error("a pattern with the wrong size should fail")
+	}
+}
+
+func TestHappyPathGenerateBytes(t *testing.T) {
+	testSchema := `{ "type" : "record", "name" : "Example", "fields" : [ { "name": "bytesField", "type": "bytes" } ] }`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			"bytes": "bytesGen",
+		},
+		Generators: map[string]string{
+			"bytesGen": "{bytes}[hex(00ff)]{1}[random_bytes(2,4)]{1}",
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	rawRes, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.FailNow()
+	}
+	res := rawRes.(map[string]interface{})["bytesField"].([]byte)
+	if !bytes.HasPrefix(res, []byte{0x00, 0xff}) || len(res) < 4 || len(res) > 6 {
+		t.Errorf("unexpected bytes %v", res)
+	}
+}
@@ -0,0 +1,85 @@
+package avrogen
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+func TestGenerateAtIndex(t *testing.T) {
+	config := eventsTestConfig()
+	config.GenerationRules[".sentAt"] = "idGen"
+	config.Generators["idGen"] = "{string}[ID-]{1}[sequence(0, 1)]{1}[-]{1}[a-z]{5}"
+	sequential, err := NewAvroGen(config, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected [][]byte
+	for i := 0; i < 100; i++ {
+		msg, _, err := sequential.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, msg)
+	}
+	// generate the same records in reverse order and in parallel
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			gen, err := NewAvroGen(config, 7)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			for i := 99 - w; i >= 0; i -= 4 {
+				msg, _, err := gen.GenerateAt(int64(i))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if !bytes.Equal(msg, expected[i]) {
+					t.Errorf("the record %d should be the same generated sequentially", i)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	// generate continues from the last index
+	msg, _, _ := sequential.GenerateAt(10)
+	next, _, _ := sequential.Generate()
+	if !bytes.Equal(msg, expected[10]) || !bytes.Equal(next, expected[11]) {
+		t.Errorf("the generation should continue from the last index")
+	}
+}
+
+func TestSequentialGenerator(t *testing.T) {
+	gen, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{Raw: `{"type": "record", "name": "Example", "fields": [{ "name": "seq", "type": "long" }]}`},
+		GenerationRules: map[string]string{
+			"key":  "keyGen",
+			".seq": "seqGen",
+		},
+		Generators: map[string]string{
+			"keyGen": "{string}[a|b]{1}",
+			"seqGen": "{long}[sequence_by_key(1, 1)]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gen.IsSequential() {
+		t.Fatal("the sequences by key depend on the previous records")
+	}
+	if _, _, err := gen.GenerateAt(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := gen.GenerateAt(5); err == nil {
+		t.Error("a sequential generator should only generate the records in order")
+	}
+	if _, _, err := gen.GenerateAt(1); err != nil {
+		t.Error(err)
+	}
+}
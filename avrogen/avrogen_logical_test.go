@@ -0,0 +1,104 @@
+package avrogen
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/andrewinci/rap/configuration"
+	"github.com/google/uuid"
+)
+
+func TestHappyPathAvroGenLogicalTypes(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "timestampMillisField", "type": { "type": "long", "logicalType": "timestamp-millis" } },
+			{ "name": "timestampMicrosField", "type": { "type": "long", "logicalType": "timestamp-micros" } },
+			{ "name": "dateField", "type": { "type": "int", "logicalType": "date" } },
+			{ "name": "timeMillisField", "type": { "type": "int", "logicalType": "time-millis" } },
+			{ "name": "timeMicrosField", "type": { "type": "long", "logicalType": "time-micros" } },
+			{ "name": "uuidField", "type": { "type": "string", "logicalType": "uuid" } },
+			{ "name": "decimalField", "type": { "type": "bytes", "logicalType": "decimal", "precision": 4, "scale": 2 } }
+		]
+	 }
+	`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	rawRes, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.FailNow()
+	}
+	res := rawRes.(map[string]interface{})
+	timestamp := res["timestampMillisField"].(time.Time)
+	if time.Since(timestamp) < 0 || time.Since(timestamp) > defaultTimeWindow {
+		t.Error("the timestamp should be in the last 30 days")
+	}
+	if res["timeMillisField"].(time.Duration) >= 24*time.Hour {
+		t.Error("the time should be within a day")
+	}
+	if _, err := uuid.Parse(res["uuidField"].(string)); err != nil {
+		t.Error("expected a valid uuid")
+	}
+	decimal := res["decimalField"].(*big.Rat)
+	if decimal.Sign() < 0 || decimal.Cmp(big.NewRat(100, 1)) >= 0 {
+		t.Errorf("the decimal %s does not respect the precision", decimal.String())
+	}
+	_, _, err = sut.Generate()
+	if err != nil {
+		t.FailNow()
+	}
+}
+
+func TestHappyPathAvroGenLogicalTypesRules(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "timestampField", "type": { "type": "long", "logicalType": "timestamp-millis" } },
+			{ "name": "longField", "type": "long" },
+			{ "name": "optionalTimestampField", "type": ["null", { "type": "long", "logicalType": "timestamp-millis" }] }
+		]
+	 }
+	`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			"timestamp-millis": "timestampGen",
+		},
+		Generators: map[string]string{
+			"timestampGen": "{long}[1645000000000]{1}",
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	rawRes, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.FailNow()
+	}
+	res := rawRes.(map[string]interface{})
+	if res["timestampField"] != int64(1645000000000) {
+		t.Error("the logical type rule should be used for the timestamp field")
+	}
+	if res["longField"] == int64(1645000000000) {
+		t.Error("the logical type rule should not be used for plain long fields")
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err = sut.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package avrogen
+
+import (
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+func TestHappyPathAvroGenMap(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Example",
+		"fields": [
+			{ "name": "attributes", "type": { "type": "map", "values" : "string" } },
+			{ "name": "optionalMap", "type": ["null", { "type": "map", "values" : "int" }] },
+			{ "name": "optionalArray", "type": ["null", { "type": "array", "items" : "int" }] }
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	res, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.FailNow()
+	}
+	if _, ok := res.(map[string]interface{})["attributes"].(map[string]interface{}); !ok {
+		t.FailNow()
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err = sut.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestHappyPathAvroGenMapRules(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Example",
+		"fields": [
+			{
+				"name": "attributes",
+				"type": {
+					"type": "map",
+					"values" : {
+						"type" : "record",
+						"name" : "MapObj",
+						"fields" : [
+							{ "name": "stringField", "type": "string" }
+						]
+					}
+				}
+			}
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".attributes.len()":                "lenGen",
+			".attributes.keys()":               "keyGen",
+			".attributes.values().stringField": "valueGen",
+		},
+		Generators: map[string]string{
+			"lenGen":   "{int}[5]{1}",
+			"keyGen":   "{string}[key-]{1}[0-9]{5}",
+			"valueGen": "{string}[test]{1}",
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	res, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.FailNow()
+	}
+	generatedMap := res.(map[string]interface{})["attributes"].(map[string]interface{})
+	if len(generatedMap) != 5 {
+		t.Errorf("expected 5 entries, received %d", len(generatedMap))
+	}
+	for k, v := range generatedMap {
+		if k[0:4] != "key-" {
+			t.Errorf("unexpected key %s", k)
+		}
+		if v.(map[string]interface{})["stringField"] != "test" {
+			t.Errorf("unexpected value %v", v)
+		}
+	}
+	_, _, err = sut.Generate()
+	if err != nil {
+		t.FailNow()
+	}
+}
@@ -0,0 +1,154 @@
+package avrogen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+	"github.com/hamba/avro"
+)
+
+const planTestSchema = `
+{
+	"type": "record",
+	"name": "Order",
+	"fields": [
+		{ "name": "id", "type": { "type": "string", "logicalType": "uuid" } },
+		{ "name": "summary", "type": "string" },
+		{ "name": "quantity", "type": "int" },
+		{ "name": "total", "type": "double" },
+		{ "name": "discount", "type": ["null", "float"] },
+		{ "name": "status", "type": { "type": "enum", "name": "Status", "symbols": ["NEW", "PAID", "SHIPPED"] } },
+		{ "name": "hash", "type": { "type": "fixed", "name": "Hash", "size": 4 } },
+		{ "name": "price", "type": { "type": "bytes", "logicalType": "decimal", "precision": 8, "scale": 2 } },
+		{ "name": "day", "type": { "type": "int", "logicalType": "date" } },
+		{ "name": "createdAt", "type": { "type": "long", "logicalType": "timestamp-micros" } },
+		{ "name": "tags", "type": { "type": "array", "items": "string" } },
+		{ "name": "attributes", "type": { "type": "map", "values": "long" } },
+		{ "name": "customer", "type": ["null", {
+			"type": "record",
+			"name": "Customer",
+			"fields": [
+				{ "name": "name", "type": "string" },
+				{ "name": "since", "type": ["null", { "type": "long", "logicalType": "timestamp-millis" }] },
+				{ "name": "flags", "type": "bytes" },
+				{ "name": "vip", "type": "boolean" }
+			]
+		}] }
+	]
+}`
+
+func planTestConfig() configuration.AvroGenConfiguration {
+	return configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{Raw: planTestSchema},
+		GenerationRules: map[string]string{
+			// the summary is generated after the quantity and the status
+			".summary":           "summaryGen",
+			".attributes.keys()": "attributeKeyGen",
+		},
+		Generators: map[string]string{
+			"summaryGen":      "{string}template({{ .quantity }} items {{ .status }})",
+			"attributeKeyGen": "{string}[a-c]{1}",
+		},
+		Clock: configuration.ClockConfiguration{Start: "2022-01-01T00:00:00Z"},
+	}
+}
+
+func TestPlanEncodesTheGeneratedValues(t *testing.T) {
+	for name, config := range map[string]configuration.AvroGenConfiguration{
+		"values": planTestConfig(),
+		"no values": {
+			Schema: configuration.SchemaConfiguration{Raw: planTestSchema},
+			Clock:  configuration.ClockConfiguration{Start: "2022-01-01T00:00:00Z"},
+		},
+	} {
+		gen, err := NewAvroGen(config, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema := gen.getSchema()
+		for i := int64(0); i < 50; i++ {
+			msg, _, err := gen.GenerateAt(i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// generate the same record as values and marshal them
+			g := gen.(avroGen)
+			g.state.startRecord(i)
+			key, _ := g.generatorsRepo["key"]()
+			g.state.record.key = key.(string)
+			values, err := gen.generate(schema, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			raw, err := avro.Marshal(schema, values)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var expected, actual interface{}
+			if err := avro.Unmarshal(schema, raw, &expected); err != nil {
+				t.Fatal(err)
+			}
+			if err := avro.Unmarshal(schema, msg[5:], &actual); err != nil {
+				t.Fatalf("%s: unable to decode the record %d, %s", name, i, err.Error())
+			}
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("%s: the record %d should encode the generated values\nexpected %v\nactual   %v", name, i, expected, actual)
+			}
+		}
+	}
+}
+
+func TestPlanEncoderErrors(t *testing.T) {
+	schema := avro.MustParse(`["null", "int", { "type": "long", "logicalType": "timestamp-millis" }]`)
+	_, err := newEncoderCompiler().compile(schema)(nil, "value")
+	expected := "unable to encode the value value (string) as int or long.timestamp-millis or null"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+	// the ints out of the int32 range, the ranges of the patterns are
+	// checked when the generator is created but not the expressions
+	gen, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{Raw: `{"type": "record", "name": "Example", "fields": [
+			{ "name": "total", "type": "long" },
+			{ "name": "count", "type": "int" }
+		]}`},
+		GenerationRules: map[string]string{".total": "totalGen", ".count": "countGen"},
+		Generators: map[string]string{
+			"totalGen": "{long}[range(3000000000, 3000000001)]{1}",
+			"countGen": "{int}expr(.total)",
+		},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := gen.Generate(); err == nil || !strings.Contains(err.Error(), "out of the range of the int type") {
+		t.Errorf("expected an error for an int out of range, got %v", err)
+	}
+}
+
+func BenchmarkGenerate(b *testing.B) {
+	for name, config := range map[string]configuration.AvroGenConfiguration{
+		"events":  eventsTestConfig(),
+		"orders":  {Schema: configuration.SchemaConfiguration{Raw: planTestSchema}},
+		"derived": planTestConfig(),
+	} {
+		b.Run(name, func(b *testing.B) {
+			gen, err := NewAvroGen(config, 0)
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			var size int64
+			for i := 0; i < b.N; i++ {
+				msg, _, err := gen.Generate()
+				if err != nil {
+					b.Fatal(err)
+				}
+				size += int64(len(msg))
+			}
+			b.SetBytes(size / int64(b.N))
+		})
+	}
+}
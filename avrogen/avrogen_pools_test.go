@@ -0,0 +1,240 @@
+package avrogen
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+const customersTestSchema = `
+{
+	"type": "record",
+	"name": "Customer",
+	"fields": [
+		{ "name": "customerId", "type": "long" },
+		{ "name": "name", "type": ["null", "string"] }
+	]
+}`
+
+const ordersTestSchema = `
+{
+	"type": "record",
+	"name": "Order",
+	"fields": [
+		{ "name": "customerId", "type": "long" },
+		{ "name": "customerKey", "type": "string" }
+	]
+}`
+
+func TestHappyAvroGenPools(t *testing.T) {
+	pools := NewValuePools()
+	customers, err := NewAvroGenWithPools(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: customersTestSchema,
+			Id:  1,
+		},
+		Publish: map[string]string{
+			".customerId": "customerIds",
+			"key":         "customerKeys",
+		}}, 0, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orders, err := NewAvroGenWithPools(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: ordersTestSchema,
+			Id:  2,
+		},
+		GenerationRules: map[string]string{
+			".customerId":  "customerIdGen",
+			".customerKey": "customerKeyGen",
+		},
+		Generators: map[string]string{
+			"customerIdGen":  "{long}pool(customerIds)",
+			"customerKeyGen": "{string}pool(customerKeys, 1.5)",
+		}}, 0, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the orders wait for the customers to be published
+	done := make(chan error)
+	go func() {
+		for i := 0; i < 10; i++ {
+			if _, _, err := orders.Generate(); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+	ids := map[string]bool{}
+	keys := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		_, key, err := customers.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[key] = true
+	}
+	customers.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range pools.pools["customerIds"].values {
+		ids[v] = true
+	}
+	for i := 0; i < 10; i++ {
+		rawRes, err := orders.generate(orders.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})
+		if !ids[toPoolValue(res["customerId"])] || !keys[res["customerKey"].(string)] {
+			t.Errorf("expected values published by the customers, got %v", res)
+		}
+	}
+}
+
+func TestAvroGenPoolsEmpty(t *testing.T) {
+	pools := NewValuePools()
+	customers, _ := NewAvroGenWithPools(configuration.AvroGenConfiguration{
+		Schema:  configuration.SchemaConfiguration{Raw: customersTestSchema},
+		Publish: map[string]string{".customerId": "customerIds"}}, 0, pools)
+	orders, err := NewAvroGenWithPools(configuration.AvroGenConfiguration{
+		Schema:          configuration.SchemaConfiguration{Raw: ordersTestSchema},
+		GenerationRules: map[string]string{".customerId": "customerIdGen"},
+		Generators:      map[string]string{"customerIdGen": "{long}pool(customerIds)"}}, 0, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the publisher completed without publishing any value
+	customers.Close()
+	if _, _, err := orders.Generate(); err == nil || !strings.Contains(err.Error(), "the pool customerIds is empty") {
+		t.Errorf("expected an empty pool error, got %v", err)
+	}
+	pools = NewValuePools()
+	orders, _ = NewAvroGenWithPools(configuration.AvroGenConfiguration{
+		Schema:          configuration.SchemaConfiguration{Raw: ordersTestSchema},
+		GenerationRules: map[string]string{".customerId": "customerIdGen"},
+		Generators:      map[string]string{"customerIdGen": "{long}pool(customerIds)"}}, 0, pools)
+	if _, _, err := orders.Generate(); err == nil || !strings.Contains(err.Error(), "no producer publishes into the pool customerIds") {
+		t.Errorf("expected a missing pool error, got %v", err)
+	}
+}
+
+func TestAvroGenPoolsInvalid(t *testing.T) {
+	invalidGenerators := []string{
+		"{long}pool()",
+		"{long}pool(a, b)",
+		"{long}pool(a, 0.5)",
+		"{long}pool(a, 2, 3)",
+		"{record}pool(a)",
+	}
+	for _, g := range invalidGenerators {
+		_, err := NewAvroGenWithPools(configuration.AvroGenConfiguration{
+			Schema:     configuration.SchemaConfiguration{Raw: ordersTestSchema},
+			Generators: map[string]string{"gen": g}}, 0, NewValuePools())
+		if err == nil {
+			t.Errorf("expected an error for the generator %s", g)
+		}
+	}
+	// pools are not available
+	_, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema:     configuration.SchemaConfiguration{Raw: ordersTestSchema},
+		Generators: map[string]string{"gen": "{long}pool(a)"}}, 0)
+	if err == nil {
+		t.Error("expected an error when the pools are not available")
+	}
+}
+
+func TestValuePoolsDrawSkew(t *testing.T) {
+	pools := NewValuePools()
+	for _, v := range []string{"a", "b", "c", "d", "e"} {
+		pools.publish("test", v)
+	}
+	random := rand.New(rand.NewSource(0))
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		v, err := pools.draw("test", 2, random, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[v]++
+	}
+	// the most recent value is the most likely
+	if counts["e"] <= counts["d"] || counts["d"] <= counts["a"] {
+		t.Errorf("expected the recent values to be more likely, got %v", counts)
+	}
+	// the oldest values are replaced once the pool is full
+	for i := 0; i < maxPoolSize; i++ {
+		pools.publish("test", "z")
+	}
+	if v, _ := pools.draw("test", 0, random, false); v != "z" || len(pools.pools["test"].values) != maxPoolSize {
+		t.Errorf("expected the oldest values to be replaced")
+	}
+}
+
+func TestAvroGenPoolsPublishFromUnion(t *testing.T) {
+	pools := NewValuePools()
+	gen, err := NewAvroGenWithPools(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{Raw: `
+		{
+			"type": "record",
+			"name": "Order",
+			"fields": [
+				{ "name": "customer", "type": ["null", {
+					"type": "record",
+					"name": "Customer",
+					"fields": [{ "name": "id", "type": "long" }]
+				}] }
+			]
+		}`},
+		Publish: map[string]string{".customer.id": "ids"}}, 0, pools)
+	if err != nil {
+		t.Fatal(err)
+	}
+	published := 0
+	for i := 0; i < 20; i++ {
+		msg, _, err := gen.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the union index of the customer follows the header
+		if msg[5] != 0 {
+			published++
+		}
+	}
+	if published == 0 || len(pools.pools["ids"].values) != published {
+		t.Errorf("expected %d ids published, got %v", published, pools.pools["ids"].values)
+	}
+}
+
+func TestCheckPools(t *testing.T) {
+	producer := func(name string, publish string, draw string) configuration.ProducerConfiguration {
+		return configuration.ProducerConfiguration{Name: name, Avro: configuration.AvroGenConfiguration{
+			Publish:    map[string]string{".id": publish},
+			Generators: map[string]string{"gen": "{long}pool(" + draw + ")"},
+		}}
+	}
+	err := CheckPools([]configuration.ProducerConfiguration{producer("A", "a", "b"), producer("B", "b", "a")})
+	if err == nil || err.Error() != "the producers A -> B -> A wait for the values of each other's pools" {
+		t.Errorf("expected a cycle error, got %v", err)
+	}
+	err = CheckPools([]configuration.ProducerConfiguration{producer("A", "a", "b"), producer("B", "b", "c"), producer("C", "c", "a")})
+	if err == nil {
+		t.Error("expected a cycle error")
+	}
+	// a producer drawing from its own pool doesn't wait
+	err = CheckPools([]configuration.ProducerConfiguration{producer("A", "a", "a"), producer("B", "b", "a")})
+	if err != nil {
+		t.Error(err)
+	}
+	// a pool without publishers
+	err = CheckPools([]configuration.ProducerConfiguration{producer("A", "a", "a"), producer("B", "b", "c")})
+	if err == nil || err.Error() != "no producer publishes into the pool c drawn by the producer B" {
+		t.Errorf("expected a missing publisher error, got %v", err)
+	}
+}
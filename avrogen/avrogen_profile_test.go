@@ -0,0 +1,140 @@
+package avrogen
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+const profileTestSchema = `
+{
+	"type": "record",
+	"name": "Example",
+	"fields": [
+		{ "name": "stringField", "type": "string", "default": "test" },
+		{ "name": "intField", "type": "int" },
+		{ "name": "bytesField", "type": "bytes", "default": "abc" },
+		{ "name": "fixedField", "type": { "type": "fixed", "name": "Two", "size": 2 }, "default": "ab" },
+		{ "name": "optionalField", "type": ["null", "string"] },
+		{ "name": "optionalDefaultField", "type": ["null", "string"], "default": null },
+		{ "name": "unionDefaultField", "type": [{ "type": "enum", "name": "Status", "symbols": ["A", "B"] }, "null"], "default": "B" },
+		{ "name": "arrayField", "type": { "type": "array", "items": "int" } },
+		{ "name": "mapField", "type": { "type": "map", "values": "int" }, "default": { "k": 1 } },
+		{ "name": "ruledField", "type": "string", "default": "default" }
+	]
+}`
+
+func TestAvroGenDefaultsProfile(t *testing.T) {
+	sut, err := newTestAvroGen(profileTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".ruledField": "stringGen",
+		},
+		Generators: map[string]string{
+			"stringGen": "{string}[ruled]{1}",
+		},
+		Profile: configuration.Defaults}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})
+		if res["stringField"] != "test" || res["optionalDefaultField"] != nil {
+			t.Error("expected the default values")
+		}
+		if res["fixedField"] != [2]byte{'a', 'b'} || string(res["bytesField"].([]byte)) != "abc" {
+			t.Error("expected the default values for bytes and fixed")
+		}
+		if res["unionDefaultField"].(map[string]interface{})["Status"] != "B" {
+			t.Error("expected the default value for the union")
+		}
+		if res["ruledField"] != "ruled" {
+			t.Error("the rules should take precedence over the defaults")
+		}
+		_, _, err = sut.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAvroGenMinimalProfile(t *testing.T) {
+	sut, err := newTestAvroGen(profileTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".ruledField": "stringGen",
+		},
+		Generators: map[string]string{
+			"stringGen": "{string}[ruled]{1}",
+		},
+		Profile: configuration.Minimal}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})
+		if res["optionalField"] != nil {
+			t.Error("optional fields should be null")
+		}
+		if len(res["arrayField"].([]interface{})) != 0 {
+			t.Error("arrays should be empty")
+		}
+		if res["mapField"].(map[string]interface{})["k"] != 1 {
+			t.Error("expected the default value for the map")
+		}
+		if res["stringField"] != "test" || res["ruledField"] != "ruled" {
+			t.Error("expected the default and the ruled values")
+		}
+		_, _, err = sut.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAvroGenDefaultsProfileBytes(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Example",
+		"fields": [
+			{ "name": "bytesField", "type": "bytes", "default": "ÿa" },
+			{ "name": "fixedField", "type": { "type": "fixed", "name": "One", "size": 1 }, "default": "ÿ" }
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		Profile: configuration.Defaults}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each code point is one byte
+	msg, _, err := sut.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0, 0, 0, 0, 1, 4, 255, 'a', 255}; !reflect.DeepEqual(msg, expected) {
+		t.Errorf("expected %v, got %v", expected, msg)
+	}
+	// the code points above 255 are not bytes
+	_, err = NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: strings.Replace(testSchema, `"ÿa"`, `"Ā"`, 1),
+			Id:  1,
+		},
+		Profile: configuration.Defaults}, 0)
+	if err == nil || !strings.Contains(err.Error(), "the code points of the bytes must be between 0 and 255") {
+		t.Errorf("expected an error for the default with a code point above 255, got %v", err)
+	}
+}
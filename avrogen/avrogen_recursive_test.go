@@ -0,0 +1,130 @@
+package avrogen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+// count the number of nested records following the field
+func countDepth(record map[string]interface{}, field string) int {
+	depth := 0
+	for record[field] != nil {
+		record = record[field].(map[string]interface{})["Node"].(map[string]interface{})
+		depth++
+	}
+	return depth
+}
+
+func TestHappyPathAvroGenRecursiveUnion(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Node",
+		"fields": [
+			{ "name": "value", "type": "int" },
+			{ "name": "next", "type": ["null", "Node"] }
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			// pick the Node side of the union for the first 5 levels
+			".next.Node.next.Node.next.Node.next.Node.next.Node.value": "intGen",
+		},
+		Generators: map[string]string{
+			"intGen": "{int}[1]{1}",
+		},
+		MaxDepth: 4}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	res, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if depth := countDepth(res.(map[string]interface{}), "next"); depth != 4 {
+		t.Errorf("expected depth 4, received %d", depth)
+	}
+	_, _, err = sut.Generate()
+	if err != nil {
+		t.FailNow()
+	}
+}
+
+func TestHappyPathAvroGenRecursiveArray(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Tree",
+		"fields": [
+			{ "name": "children", "type": { "type": "array", "items": "Tree" } },
+			{ "name": "attributes", "type": { "type": "map", "values": "Tree" } }
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err = sut.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAvroGenRecursiveNonNullable(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Node",
+		"fields": [
+			{ "name": "value", "type": "int" },
+			{ "name": "next", "type": ["string", "Node"] }
+		]
+	}`
+	_, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".next.Node.next.Node.next.Node.value": "intGen",
+		},
+		Generators: map[string]string{
+			"intGen": "{int}[1]{1}",
+		},
+		MaxDepth: 2}, 0)
+	if err == nil {
+		t.Error("expected an error for a recursive field that is not nullable")
+	}
+}
+
+func TestAvroGenRecursiveRecordNotInUnion(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Node",
+		"fields": [
+			{ "name": "value", "type": "int" },
+			{ "name": "next", "type": "Node" }
+		]
+	}`
+	_, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "max depth") {
+		t.Errorf("expected a max depth error when the generator is created, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package avrogen
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/andrewinci/rap/configuration"
@@ -134,7 +135,7 @@ func TestHappyAvroGenEnum(t *testing.T) {
 	if err != nil {
 		t.FailNow()
 	}
-	if res.(map[string]interface{})["testField"] != "HEARTS" {
+	if res.(map[string]interface{})["testField"] != "DIAMONDS" {
 		t.FailNow()
 	}
 	_, _, err = sut.Generate()
@@ -186,3 +187,125 @@ func TestHappyAvroGenEnum2(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestHappyAvroGenSequenceByKey(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Example",
+		"fields": [ { "name": "seq", "type": "long" } ]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			"key":  "keyGen",
+			".seq": "seqGen",
+		},
+		Generators: map[string]string{
+			"keyGen": "{string}[a|b]{1}",
+			"seqGen": "{long}[sequence_by_key(1, 1)]{1}",
+		}}, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	counts := map[string]int{}
+	for i := 0; i < 20; i++ {
+		msg, key, err := sut.Generate()
+		if err != nil {
+			t.FailNow()
+		}
+		counts[key] += 1
+		// the avro long is zig-zag encoded after the magic byte and the schema id
+		if int(msg[5]) != counts[key]*2 {
+			t.Errorf("expected sequence %d for the key %s, received %d", counts[key], key, msg[5]/2)
+		}
+	}
+	// the default keys are unique
+	_, err = NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".seq": "seqGen",
+		},
+		Generators: map[string]string{
+			"seqGen": "{long}[sequence_by_key(1, 1)]{1}",
+		}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "sequence_by_key() but the record key is not generated by a `key` rule") {
+		t.Errorf("expected an error for the sequence by key without a key rule, got %v", err)
+	}
+}
+
+func TestHappyAvroGenLocale(t *testing.T) {
+	testSchema := `
+	{
+		"type": "record",
+		"name": "Example",
+		"fields": [
+			{ "name": "city", "type": "string" },
+			{ "name": "ukCity", "type": "string" }
+		]
+	}`
+	config := configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".city":   "cityGen",
+			".ukCity": "ukCityGen",
+		},
+		Generators: map[string]string{
+			"cityGen":   "{string}[city()]{1}",
+			"ukCityGen": "{string}[city()]{1}",
+		},
+		Locale: "it_IT",
+		GeneratorLocales: map[string]string{
+			"ukCityGen": "en_GB",
+		}}
+	sut, err := NewAvroGen(config, 0)
+	if err != nil {
+		t.FailNow()
+	}
+	contains := func(values []string, value interface{}) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+	for i := 0; i < 10; i++ {
+		res, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.FailNow()
+		}
+		if !contains(itITLocale.cities, res.(map[string]interface{})["city"]) {
+			t.Error("expected an italian city")
+		}
+		if !contains(enGBLocale.cities, res.(map[string]interface{})["ukCity"]) {
+			t.Error("expected a british city")
+		}
+	}
+	// unsupported locales and missing generators should fail
+	config.Locale = "xx_XX"
+	if _, err = NewAvroGen(config, 0); err == nil {
+		t.Error("expected an error for an unsupported locale")
+	}
+	config.Locale = ""
+	config.GeneratorLocales = map[string]string{"missingGen": "en_GB"}
+	if _, err = NewAvroGen(config, 0); err == nil {
+		t.Error("expected an error for a locale of a missing generator")
+	}
+}
+
+// create a generator for the raw schema with the rules and
+// the generators of the configuration
+func newTestAvroGen(schema string, config configuration.AvroGenConfiguration, seed int64) (AvroGen, error) {
+	config.Schema = configuration.SchemaConfiguration{Raw: schema, Id: 1}
+	return NewAvroGenWithPools(config, seed, NewValuePools())
+}
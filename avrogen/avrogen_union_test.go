@@ -1,6 +1,8 @@
 package avrogen
 
 import (
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/andrewinci/rap/configuration"
@@ -35,7 +37,7 @@ func TestHappyAvroGenUnion(t *testing.T) {
 		t.FailNow()
 	}
 	res := rawRes.(map[string]interface{})["booleanField"]
-	if res != false {
+	if res != true {
 		t.FailNow()
 	}
 	_, _, err = sut.Generate()
@@ -171,3 +173,302 @@ func TestHappyAvroGenUnion4(t *testing.T) {
 		t.FailNow()
 	}
 }
+
+func TestAvroGenUnionNullProbability(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "stringField", "type": ["null", "string"] },
+			{ "name": "intField", "type": ["null", "int"] },
+			{ "name": "recordField", "type": ["null", { "type": "record", "name": "Sub", "fields": [{ "name": "value", "type": "string" }] }] }
+		]
+	 }
+	`
+	nullProbability := 0.05
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".recordField.Sub.value": "valueGen",
+		},
+		Generators: map[string]string{
+			"valueGen": "{string}[test]{1}",
+		},
+		NullProbability: &nullProbability,
+		NullProbabilities: map[string]float64{
+			".intField":    1,
+			".recordField": 0.5,
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nulls := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range rawRes.(map[string]interface{}) {
+			if v == nil {
+				nulls[k]++
+			}
+		}
+	}
+	if nulls["stringField"] < 20 || nulls["stringField"] > 80 {
+		t.Errorf("expected around 5%% of nulls, got %d", nulls["stringField"])
+	}
+	if nulls["intField"] != 1000 {
+		t.Errorf("expected only nulls, got %d", nulls["intField"])
+	}
+	// the null probability applies to the unions with a nested rule
+	if nulls["recordField"] < 400 || nulls["recordField"] > 600 {
+		t.Errorf("expected around 50%% of nulls, got %d", nulls["recordField"])
+	}
+}
+
+const unionSelectionTestSchema = `
+{
+	"type": "record",
+	"name": "Envelope",
+	"namespace": "com.example",
+	"fields": [
+		{
+			"name": "payment",
+			"type": [
+				"null",
+				{ "type": "record", "name": "CardPayment", "fields": [{ "name": "card", "type": "string" }] },
+				{ "type": "record", "name": "BankTransfer", "fields": [{ "name": "iban", "type": "string" }] },
+				{ "type": "enum", "name": "Cash", "symbols": ["EUR", "USD"] },
+				{ "type": "fixed", "name": "Token", "size": 4 },
+				{ "type": "array", "items": "int" },
+				{ "type": "map", "values": "int" },
+				"string",
+				{ "type": "long", "logicalType": "timestamp-millis" }
+			]
+		}
+	]
+}`
+
+func TestAvroGenUnionSelectionWeights(t *testing.T) {
+	sut, err := newTestAvroGen(unionSelectionTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".payment.union()":                       "CardPayment:70|com.example.BankTransfer:30",
+			".payment.CardPayment.card":              "cardGen",
+			".payment.com.example.BankTransfer.iban": "ibanGen",
+		},
+		Generators: map[string]string{
+			"cardGen": "{string}[card]{1}",
+			"ibanGen": "{string}[iban]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k := range rawRes.(map[string]interface{})["payment"].(map[string]interface{}) {
+			counts[k]++
+		}
+	}
+	if len(counts) != 2 || counts["com.example.CardPayment"] < 650 || counts["com.example.CardPayment"] > 750 {
+		t.Errorf("expected 70%% of card payments, got %v", counts)
+	}
+}
+
+func TestAvroGenUnionSelectionTypes(t *testing.T) {
+	cases := map[string]string{
+		"null":                  "",
+		"Cash":                  "com.example.Cash",
+		"com.example.Token":     "com.example.Token",
+		"array":                 "array",
+		"map":                   "map",
+		"string":                "",
+		"long.timestamp-millis": "long.timestamp-millis",
+		"long":                  "long.timestamp-millis",
+	}
+	for typeName, wrapper := range cases {
+		sut, err := newTestAvroGen(unionSelectionTestSchema, configuration.AvroGenConfiguration{
+			GenerationRules: map[string]string{".payment.union()": typeName}}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rawRes, err := sut.generate(sut.getSchema(), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := rawRes.(map[string]interface{})["payment"]
+		switch {
+		case typeName == "null" && res != nil:
+			t.Errorf("expected null, got %v", res)
+		case typeName == "string":
+			if _, ok := res.(string); !ok {
+				t.Errorf("expected a string, got %v", res)
+			}
+		case wrapper != "":
+			if _, ok := res.(map[string]interface{})[wrapper]; !ok {
+				t.Errorf("expected the type %s, got %v", wrapper, res)
+			}
+		}
+		if _, _, err := sut.Generate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAvroGenUnionSelectionGenerator(t *testing.T) {
+	sut, err := newTestAvroGen(unionSelectionTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			".payment.union()": "paymentGen",
+			".payment.Cash":    "cashGen",
+		},
+		Generators: map[string]string{
+			"paymentGen": "{string}[Cash]{1}",
+			"cashGen":    "{string}[USD]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawRes, err := sut.generate(sut.getSchema(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rawRes.(map[string]interface{})["payment"].(map[string]interface{})["com.example.Cash"] != "USD" {
+		t.Errorf("expected the rule of the enum, got %v", rawRes)
+	}
+	// unknown type
+	_, err = newTestAvroGen(unionSelectionTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{".payment.union()": "Cheque"}}, 0)
+	if err == nil || !strings.Contains(err.Error(), "the rule .payment.union() references the type Cheque that is not in the union") {
+		t.Errorf("expected an error for the unknown type, got %v", err)
+	}
+	// invalid list of types
+	_, err = newTestAvroGen(unionSelectionTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{".payment.union()": "Cash:0|Token:1"}}, 0)
+	if err == nil {
+		t.Error("expected an error for the invalid list of types")
+	}
+}
+
+func TestAvroGenUnionSelectionDeterministic(t *testing.T) {
+	rules := map[string]string{
+		".payment.CardPayment.card":  "cardGen",
+		".payment.BankTransfer.iban": "ibanGen",
+	}
+	generate := func() []interface{} {
+		sut, err := newTestAvroGen(unionSelectionTestSchema, configuration.AvroGenConfiguration{
+			GenerationRules: rules,
+			Generators: map[string]string{
+				"cardGen": "{string}[card]{1}",
+				"ibanGen": "{string}[iban]{1}",
+			}}, 42)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var res []interface{}
+		for i := 0; i < 50; i++ {
+			rawRes, err := sut.generate(sut.getSchema(), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			res = append(res, rawRes)
+		}
+		return res
+	}
+	first := generate()
+	seen := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		if !reflect.DeepEqual(first, generate()) {
+			t.Fatal("expected the same records with the same seed")
+		}
+	}
+	// only the types with a rule are picked
+	for _, r := range first {
+		for k := range r.(map[string]interface{})["payment"].(map[string]interface{}) {
+			seen[k] = true
+		}
+	}
+	if len(seen) != 2 || !seen["com.example.CardPayment"] || !seen["com.example.BankTransfer"] {
+		t.Errorf("expected only the types with a rule, got %v", seen)
+	}
+}
+
+func TestAvroGenUnionFloatGeneratorOnDouble(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "d", "type": ["null", "double"] },
+			{ "name": "f", "type": ["null", "double", "float"] }
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".d": "floatGen",
+			".f": "floatGen",
+		},
+		Generators: map[string]string{
+			"floatGen": "{float}[1.5]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := sut.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the float is widened to the double branch
+	// unless the union has a float branch
+	expected := []byte{0, 0, 0, 0, 1, 2, 0, 0, 0, 0, 0, 0, 0xf8, 0x3f, 4, 0, 0, 0xc0, 0x3f}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v", expected, res)
+	}
+}
+
+func TestAvroGenUnionLogicalTypeWithUnderlyingGenerator(t *testing.T) {
+	testSchema := `
+	{
+		"type" : "record",
+		"name" : "Example",
+		"fields" : [
+			{ "name": "createdAt", "type": ["null", { "type": "long", "logicalType": "timestamp-millis" }] },
+			{ "name": "day", "type": ["null", { "type": "int", "logicalType": "date" }] }
+		]
+	}`
+	sut, err := NewAvroGen(configuration.AvroGenConfiguration{
+		Schema: configuration.SchemaConfiguration{
+			Raw: testSchema,
+			Id:  1,
+		},
+		GenerationRules: map[string]string{
+			".createdAt": "longGen",
+			".day":       "intGen",
+		},
+		Generators: map[string]string{
+			"longGen": "{long}[range(5,5)]{1}",
+			"intGen":  "{int}[range(3,3)]{1}",
+		}}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _, err := sut.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the values are encoded in the logical type branch
+	expected := []byte{0, 0, 0, 0, 1, 2, 10, 2, 6}
+	if !reflect.DeepEqual(res, expected) {
+		t.Errorf("expected %v, got %v", expected, res)
+	}
+}
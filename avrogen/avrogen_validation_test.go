@@ -0,0 +1,170 @@
+package avrogen
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/andrewinci/rap/configuration"
+)
+
+const validationTestSchema = `
+{
+	"type": "record",
+	"name": "Example",
+	"namespace": "com.example",
+	"fields": [
+		{ "name": "intField", "type": "int" },
+		{ "name": "doubleField", "type": "double" },
+		{ "name": "timestampField", "type": { "type": "long", "logicalType": "timestamp-millis" } },
+		{ "name": "enumField", "type": { "type": "enum", "name": "Suit", "symbols": ["SPADES", "HEARTS"] } },
+		{ "name": "fixedField", "type": { "type": "fixed", "name": "MD5", "size": 16 } },
+		{ "name": "optionalField", "type": ["null", "string", { "type": "record", "name": "Sub", "fields": [{ "name": "value", "type": "string" }] }] },
+		{ "name": "arrayField", "type": { "type": "array", "items": "string" } },
+		{ "name": "mapField", "type": { "type": "map", "values": "Sub" } }
+	]
+}`
+
+func TestAvroGenValidationHappyPath(t *testing.T) {
+	_, err := newTestAvroGen(validationTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			"key":                      "stringGen",
+			"int":                      "intGen",
+			"timestamp-millis":         "longGen",
+			"com.example.MD5":          "bytesGen",
+			".intField":                "intGen",
+			".doubleField":             "floatGen",
+			".timestampField":          "longGen",
+			".enumField":               "stringGen",
+			".fixedField":              "bytesGen",
+			".optionalField":           "nullGen if .intField == 1 else stringGen",
+			".optionalField.union()":   "nameGen",
+			".optionalField.Sub.value": "stringGen",
+			".arrayField":              "stringGen",
+			".arrayField.len()":        "intGen",
+			".mapField.keys()":         "stringGen",
+			".mapField.values().value": "stringGen",
+			".mapField.len()":          "intGen",
+		},
+		Generators: map[string]string{
+			"intGen":    "{int}[1]{1}",
+			"longGen":   "{long}[1]{1}",
+			"floatGen":  "{float}[1]{1}",
+			"stringGen": "{string}[a]{1}",
+			"bytesGen":  "{bytes}[random_bytes(16,16)]{1}",
+			"nullGen":   "{null}[null]{1}",
+			"nameGen":   "{string}[Sub]{1}",
+		},
+		Publish:           map[string]string{".optionalField.com.example.Sub.value": "values", "key": "keys"},
+		NullProbabilities: map[string]float64{".optionalField": 0.1},
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAvroGenValidationReportsAllProblems(t *testing.T) {
+	_, err := newTestAvroGen(validationTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			"key":                    "intGen",
+			"MD4":                    "bytesGen",
+			".missingField":          "intGen",
+			".intField":              "stringGen",
+			".timestampField":        "stringGen",
+			".optionalField":         "longGen",
+			".optionalField.union()": "Sub|Other",
+			".arrayField.len()":      "longGen",
+			".mapField":              "stringGen",
+			".doubleField":           "intGen if .nothing == 1",
+			".enumField":             "templateGen",
+			".fixedField":            "invalidGen",
+		},
+		Generators: map[string]string{
+			"intGen":      "{int}[1]{1}",
+			"longGen":     "{long}[1]{1}",
+			"stringGen":   "{string}[a]{1}",
+			"bytesGen":    "{bytes}[random_bytes(16,16)]{1}",
+			"templateGen": "{string}template({{ .missing }})",
+			"invalidGen":  "{string}[a]",
+		},
+		Publish:           map[string]string{".nothing": "pool"},
+		NullProbabilities: map[string]float64{".intField": 0.1},
+	}, 0)
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	expected := []string{
+		"the generator intGen of the rule key generates int values, but string is expected",
+		"the rule MD4 doesn't target a path, a type or a fixed of the schema",
+		"the path of the rule .missingField doesn't exist in the schema",
+		"the generator stringGen of the rule .intField generates string values, but the field is int",
+		"the generator stringGen of the rule .timestampField generates string values, but the field is long.timestamp-millis",
+		"the generator longGen of the rule .optionalField generates long values, but the field is null or record or string",
+		"the rule .optionalField.union() references the type Other that is not in the union",
+		"the generator longGen of the rule .arrayField.len() generates long values, but the field is int",
+		"the generator stringGen of the rule .mapField generates string values, but the field is map",
+		"the condition of the rule .doubleField references the missing field .nothing",
+		"the generator intGen of the rule .doubleField generates int values, but the field is double",
+		"the generator templateGen of the rule .enumField references the missing field .missing",
+		"invalid pattern {string}[a] of the generator invalidGen",
+		"the path .nothing published into the pool pool doesn't exist in the schema",
+		"the null probability is set for the field .intField that is not nullable",
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("expected the problem `%s` in\n%s", e, err.Error())
+		}
+	}
+}
+
+func TestAvroGenValidationSequences(t *testing.T) {
+	generators := map[string]string{
+		"seqGen":       "{string}[ID-]{1}[sequence(0, 1)]{1}",
+		"itemSeqGen":   "{string}[sequence(0, 1)]{1}",
+		"keySeqGen":    "{string}[sequence(0, 1)]{1}",
+		"valueSeqGen":  "{string}[sequence(0, 1)]{1}",
+		"typeSeqGen":   "{int}[sequence(0, 1)]{1}",
+		"lengthSeqGen": "{int}[sequence(1, 0)]{1}",
+	}
+	_, err := newTestAvroGen(validationTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			"key":                      "seqGen",
+			".optionalField.Sub.value": "seqGen",
+			".arrayField":              "itemSeqGen",
+			".mapField.keys()":         "keySeqGen",
+			".mapField.values().value": "valueSeqGen",
+			"int":                      "typeSeqGen",
+			".arrayField.len()":        "lengthSeqGen",
+		},
+		Generators: generators,
+	}, 0)
+	if err == nil {
+		t.Fatal("expected a validation error")
+	}
+	expected := []string{
+		"the generator seqGen uses sequence() in more than one rule: .optionalField.Sub.value, key",
+		"the generator itemSeqGen uses sequence() in the rule .arrayField that generates more than one value per record",
+		"the generator keySeqGen uses sequence() in the rule .mapField.keys() that generates more than one value per record",
+		"the generator valueSeqGen uses sequence() in the rule .mapField.values().value that generates more than one value per record",
+		"the generator typeSeqGen uses sequence() in the rule int that generates more than one value per record",
+	}
+	for _, e := range expected {
+		if !strings.Contains(err.Error(), e) {
+			t.Errorf("expected the problem `%s` in\n%s", e, err.Error())
+		}
+	}
+	if strings.Contains(err.Error(), "lengthSeqGen") {
+		t.Errorf("the length of the arrays is generated once per record, got\n%s", err.Error())
+	}
+	// the sequences used once per record
+	_, err = newTestAvroGen(validationTestSchema, configuration.AvroGenConfiguration{
+		GenerationRules: map[string]string{
+			"key":                      "seqGen",
+			".optionalField.Sub.value": "itemSeqGen",
+			".arrayField.len()":        "lengthSeqGen",
+		},
+		Generators: generators,
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
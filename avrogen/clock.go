@@ -0,0 +1,48 @@
+package avrogen
+
+import (
+	"fmt"
+	"time"
+
+	c "github.com/andrewinci/rap/configuration"
+)
+
+// step of the simulated clock if not configured
+const defaultClockStep = time.Second
+
+// clock used by the time based generators, either the
+// wall clock or a simulated clock that advances at each record
+type clock struct {
+	simulated bool
+	start     time.Time
+	step      time.Duration
+}
+
+func newClock(config c.ClockConfiguration) (*clock, error) {
+	if config.Start == "" {
+		if config.Step != "" {
+			return nil, fmt.Errorf("the step of the clock requires the start time")
+		}
+		return &clock{}, nil
+	}
+	start, err := time.Parse(time.RFC3339, config.Start)
+	if err != nil {
+		return nil, fmt.Errorf("invalid start time of the clock %s, expected RFC3339 e.g. 2022-01-01T00:00:00Z", config.Start)
+	}
+	step := defaultClockStep
+	if config.Step != "" {
+		step, err = time.ParseDuration(config.Step)
+		if err != nil || step < 0 {
+			return nil, fmt.Errorf("invalid step of the clock %s, expected a non negative duration e.g. 100ms", config.Step)
+		}
+	}
+	return &clock{simulated: true, start: start.UTC(), step: step}, nil
+}
+
+// time of the record at the index
+func (c *clock) now(index int64) time.Time {
+	if !c.simulated {
+		return time.Now()
+	}
+	return c.start.Add(time.Duration(index) * c.step)
+}
@@ -0,0 +1,103 @@
+package avrogen
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// keywords that can be used in place of a generator
+// in the conditional rules
+const (
+	// generate null
+	nullTarget = "null"
+	// generate one of the non null types of the union
+	notNullTarget = "not_null"
+)
+
+// branch of a rule like `gen1 if .type == A else gen2`
+type ruleBranch struct {
+	// nil for the final else branch
+	condition *ruleCondition
+	// name of the generator or one of the keywords
+	target string
+	gen    fieldGen
+}
+
+type ruleCondition struct {
+	path   string
+	negate bool
+	values []string
+}
+
+// parse a generation rule. A rule without conditions returns a single branch.
+// Branches are separated by `else`, e.g.
+// `negativeGen if .type == REFUND else zeroGen if .type == VOID|CANCELLED else positiveGen`
+func parseRule(raw string) ([]ruleBranch, error) {
+	var branchRe = regexp.MustCompile(`^(\S+)\s+if\s+(\.\S+)\s*(==|!=)\s*(.+)$`)
+	parts := regexp.MustCompile(`\s+else\s+`).Split(strings.Trim(raw, " "), -1)
+	var res []ruleBranch
+	for i, p := range parts {
+		matches := branchRe.FindStringSubmatch(p)
+		if matches == nil {
+			if strings.ContainsAny(p, " \t") {
+				return nil, fmt.Errorf("invalid condition `%s`", p)
+			}
+			// only the last branch can be unconditional
+			if i != len(parts)-1 {
+				return nil, fmt.Errorf("missing condition for the generator %s", p)
+			}
+			res = append(res, ruleBranch{target: p})
+			continue
+		}
+		var values []string
+		for _, v := range strings.Split(matches[4], "|") {
+			values = append(values, strings.Trim(v, " "))
+		}
+		res = append(res, ruleBranch{
+			target: matches[1],
+			condition: &ruleCondition{
+				path:   matches[2],
+				negate: matches[3] == "!=",
+				values: values,
+			},
+		})
+	}
+	return res, nil
+}
+
+// evaluate the condition against the partially generated record.
+// Fields that are not available, e.g. because nested in a null
+// union, are compared as null
+func (c ruleCondition) matches(view map[string]interface{}) bool {
+	value, err := lookup(view, c.path)
+	if err != nil {
+		value = nil
+	}
+	// unwrap the values of the unions
+	if m, ok := value.(map[string]interface{}); ok && len(m) == 1 {
+		for _, v := range m {
+			value = v
+		}
+	}
+	s := nullTarget
+	if value != nil {
+		s = fmt.Sprint(value)
+	}
+	for _, v := range c.values {
+		if v == s {
+			return !c.negate
+		}
+	}
+	return c.negate
+}
+
+// return the first branch whose condition is satisfied
+func pickBranch(branches []ruleBranch, view map[string]interface{}) (ruleBranch, bool) {
+	for _, b := range branches {
+		if b.condition == nil || b.condition.matches(view) {
+			return b, true
+		}
+	}
+	return ruleBranch{}, false
+}
@@ -0,0 +1,455 @@
+package avrogen
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// generator that computes the value from other fields of the record
+type derivedFieldGen struct {
+	gen fieldGen
+	// paths of the fields referenced by the generator
+	references []string
+}
+
+// parse a derived generator like `{string}template({{ lower .Name }}@example.com)`
+// or `{double}expr(.price * .qty)`. Returns false if the raw generator is not
+// a derived generator.
+func newDerivedFieldGen(raw string, state *generatorState) (*derivedFieldGen, bool, error) {
+	var re = regexp.MustCompile(`^\{([a-z]+)\}(template|expr)\((.*)\)$`)
+	matches := re.FindStringSubmatch(raw)
+	if matches == nil {
+		return nil, false, nil
+	}
+	avroType, kind, body := matches[1], matches[2], matches[3]
+	supportedTypes := map[string]bool{"int": true, "long": true, "float": true, "double": true, "string": true}
+	if kind == "template" {
+		supportedTypes["boolean"], supportedTypes["bytes"] = true, true
+	}
+	if !supportedTypes[avroType] {
+		return nil, true, fmt.Errorf("the %s generator doesn't support the type %s", kind, avroType)
+	}
+	if kind == "template" {
+		res, err := newTemplateFieldGen(avroType, body, state.record)
+		return res, true, err
+	}
+	res, err := newExpressionFieldGen(avroType, body, state.record)
+	return res, true, err
+}
+
+func newTemplateFieldGen(avroType string, body string, record *recordState) (*derivedFieldGen, error) {
+	tmpl, err := template.New("").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{
+			"lower":   strings.ToLower,
+			"upper":   strings.ToUpper,
+			"trim":    strings.TrimSpace,
+			"replace": strings.ReplaceAll,
+		}).
+		Parse(body)
+	if err != nil {
+		return nil, err
+	}
+	references := []string{}
+	if err := collectTemplateReferences(tmpl.Tree.Root, &references); err != nil {
+		return nil, err
+	}
+	// the parents are set before the nested fields
+	sort.Strings(references)
+	return &derivedFieldGen{
+		references: references,
+		gen: func() (interface{}, error) {
+			data, err := templateData(record.view(), references)
+			if err != nil {
+				return nil, err
+			}
+			var res strings.Builder
+			if err := tmpl.Execute(&res, data); err != nil {
+				return nil, err
+			}
+			return parseValue(avroType, res.String())
+		},
+	}, nil
+}
+
+// collect the fields used in the template. The nodes that change the
+// dot or use variables are not supported, because the fields would
+// not be relative to the record
+func collectTemplateReferences(node parse.Node, references *[]string) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			if err := collectTemplateReferences(c, references); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return collectTemplateReferences(n.Pipe, references)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		if len(n.Decl) > 0 {
+			return fmt.Errorf("the variables are not supported in the templates: %s", n)
+		}
+		for _, c := range n.Cmds {
+			if err := collectTemplateReferences(c, references); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			if err := collectTemplateReferences(a, references); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		for _, c := range []parse.Node{n.Pipe, n.List, n.ElseList} {
+			if err := collectTemplateReferences(c, references); err != nil {
+				return err
+			}
+		}
+	case *parse.FieldNode:
+		*references = append(*references, "."+strings.Join(n.Ident, "."))
+	case *parse.TextNode, *parse.IdentifierNode, *parse.StringNode, *parse.NumberNode, *parse.BoolNode, *parse.NilNode:
+	default:
+		return fmt.Errorf("only the fields, the functions and `if` are supported in the templates, found %s", node)
+	}
+	return nil
+}
+
+// build the data of the template with the referenced fields, the
+// values of the unions are unwrapped as in the expressions
+func templateData(view map[string]interface{}, references []string) (map[string]interface{}, error) {
+	data := map[string]interface{}{}
+	for _, r := range references {
+		value, err := lookup(view, r)
+		if err != nil {
+			return nil, err
+		}
+		segments := strings.Split(strings.TrimPrefix(r, "."), ".")
+		current := data
+		for _, s := range segments[:len(segments)-1] {
+			next, ok := current[s].(map[string]interface{})
+			if ok {
+				next = copyMap(next)
+			} else {
+				next = map[string]interface{}{}
+			}
+			current[s] = next
+			current = next
+		}
+		current[segments[len(segments)-1]] = value
+	}
+	return data, nil
+}
+
+func newExpressionFieldGen(avroType string, body string, record *recordState) (*derivedFieldGen, error) {
+	p := expressionParser{input: body}
+	expression, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &derivedFieldGen{
+		references: p.references,
+		gen: func() (interface{}, error) {
+			value, err := expression(record.view())
+			if err != nil {
+				return nil, err
+			}
+			return fromNumber(avroType, value)
+		},
+	}, nil
+}
+
+// convert the result of an expression into the avro type
+func fromNumber(avroType string, value interface{}) (interface{}, error) {
+	f, isFloat := value.(float64)
+	if !isFloat {
+		f = float64(value.(int64))
+	}
+	switch avroType {
+	case "int":
+		return int(math.Round(f)), nil
+	case "long":
+		if !isFloat {
+			return value.(int64), nil
+		}
+		return int64(math.Round(f)), nil
+	case "float":
+		return float32(f), nil
+	case "double":
+		return f, nil
+	case "string":
+		if !isFloat {
+			return strconv.FormatInt(value.(int64), 10), nil
+		}
+		return strconv.FormatFloat(f, 'f', -1, 64), nil
+	}
+	return nil, fmt.Errorf("expressions can't generate the avro type %s", avroType)
+}
+
+// return a view of the record being generated where the nested
+// records are available at their path, e.g. `.SubRecord.Name`.
+// For arrays and maps, only the current item is available.
+func (r *recordState) view() map[string]interface{} {
+	if len(r.frames) == 0 {
+		return map[string]interface{}{}
+	}
+	root := copyMap(r.frames[0].record)
+	for _, f := range r.frames[1:] {
+		relativePath := strings.TrimPrefix(f.path, r.frames[0].path)
+		segments := strings.Split(strings.TrimPrefix(relativePath, "."), ".")
+		current := root
+		for _, s := range segments[:len(segments)-1] {
+			next, ok := current[s].(map[string]interface{})
+			if ok {
+				next = copyMap(next)
+			} else {
+				next = map[string]interface{}{}
+			}
+			current[s] = next
+			current = next
+		}
+		current[segments[len(segments)-1]] = copyMap(f.record)
+	}
+	return root
+}
+
+func copyMap(m map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		res[k] = v
+	}
+	return res
+}
+
+// return the value at the path in the record view
+func lookup(view map[string]interface{}, path string) (interface{}, error) {
+	var current interface{} = view
+	for _, s := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("the field %s is not available", path)
+		}
+		next, ok := m[s]
+		// step through the values of the unions, wrapped into
+		// a map with the type name as only key
+		for !ok && len(m) == 1 {
+			for _, v := range m {
+				m, ok = v.(map[string]interface{})
+			}
+			if !ok {
+				break
+			}
+			next, ok = m[s]
+		}
+		if !ok {
+			return nil, fmt.Errorf("the field %s is not available", path)
+		}
+		current = next
+	}
+	return current, nil
+}
+
+// compiled expression that returns an int64 or a float64
+type expression func(view map[string]interface{}) (interface{}, error)
+
+// recursive descent parser for arithmetic expressions with
+// the operators + - * / %, parenthesis, numbers and field paths
+type expressionParser struct {
+	input      string
+	pos        int
+	references []string
+}
+
+func (p *expressionParser) parse() (expression, error) {
+	res, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected character '%c' at col %d in the expression %s", p.input[p.pos], p.pos+1, p.input)
+	}
+	return res, nil
+}
+
+func (p *expressionParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *expressionParser) parseSum() (expression, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '+' && p.input[p.pos] != '-') {
+			return left, nil
+		}
+		operator := p.input[p.pos]
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpression(operator, left, right)
+	}
+}
+
+func (p *expressionParser) parseProduct() (expression, error) {
+	left, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || !strings.ContainsRune("*/%", rune(p.input[p.pos])) {
+			return left, nil
+		}
+		operator := p.input[p.pos]
+		p.pos++
+		right, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryExpression(operator, left, right)
+	}
+}
+
+func (p *expressionParser) parseFactor() (expression, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("unexpected end of the expression %s", p.input)
+	}
+	switch c := p.input[p.pos]; {
+	case c == '-':
+		p.pos++
+		operand, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return binaryExpression('-', func(map[string]interface{}) (interface{}, error) { return int64(0), nil }, operand), nil
+	case c == '(':
+		p.pos++
+		res, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, fmt.Errorf("missing ')' at col %d in the expression %s", p.pos+1, p.input)
+		}
+		p.pos++
+		return res, nil
+	case c == '.':
+		path := regexp.MustCompile(`^(\.[A-Za-z_][A-Za-z0-9_]*(\(\))?)+`).FindString(p.input[p.pos:])
+		if path == "" {
+			return nil, fmt.Errorf("invalid field at col %d in the expression %s", p.pos+1, p.input)
+		}
+		p.pos += len(path)
+		p.references = append(p.references, path)
+		return func(view map[string]interface{}) (interface{}, error) {
+			value, err := lookup(view, path)
+			if err != nil {
+				return nil, err
+			}
+			return toNumber(path, value)
+		}, nil
+	case c >= '0' && c <= '9':
+		raw := regexp.MustCompile(`^[0-9]+(\.[0-9]+)?`).FindString(p.input[p.pos:])
+		p.pos += len(raw)
+		var value interface{}
+		if strings.Contains(raw, ".") {
+			value, _ = strconv.ParseFloat(raw, 64)
+		} else {
+			value, _ = strconv.ParseInt(raw, 10, 64)
+		}
+		return func(map[string]interface{}) (interface{}, error) { return value, nil }, nil
+	default:
+		return nil, fmt.Errorf("unexpected character '%c' at col %d in the expression %s", c, p.pos+1, p.input)
+	}
+}
+
+// convert the value of a field into an int64 or a float64
+func toNumber(path string, value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	}
+	return nil, fmt.Errorf("the field %s is not a number", path)
+}
+
+// the operation is computed on int64 if both the operands
+// are int64, otherwise on float64
+func binaryExpression(operator byte, left expression, right expression) expression {
+	return func(view map[string]interface{}) (interface{}, error) {
+		l, err := left(view)
+		if err != nil {
+			return nil, err
+		}
+		r, err := right(view)
+		if err != nil {
+			return nil, err
+		}
+		li, lIsInt := l.(int64)
+		ri, rIsInt := r.(int64)
+		if lIsInt && rIsInt {
+			switch operator {
+			case '+':
+				return li + ri, nil
+			case '-':
+				return li - ri, nil
+			case '*':
+				return li * ri, nil
+			}
+			if ri == 0 {
+				return nil, fmt.Errorf("division by zero")
+			}
+			if operator == '/' {
+				return li / ri, nil
+			}
+			return li % ri, nil
+		}
+		lf, rf := toFloat(l), toFloat(r)
+		switch operator {
+		case '+':
+			return lf + rf, nil
+		case '-':
+			return lf - rf, nil
+		case '*':
+			return lf * rf, nil
+		case '/':
+			return lf / rf, nil
+		}
+		return math.Mod(lf, rf), nil
+	}
+}
+
+func toFloat(value interface{}) float64 {
+	if i, ok := value.(int64); ok {
+		return float64(i)
+	}
+	return value.(float64)
+}
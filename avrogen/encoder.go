@@ -0,0 +1,422 @@
+package avrogen
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/hamba/avro"
+)
+
+// encoder of a value into the avro binary format, compiled once
+// per schema instead of walking the schema with reflection
+type valueEncoder func(buf []byte, value interface{}) ([]byte, error)
+
+// compiler of the encoders, the encoders of the named
+// types are shared to support the recursive schemas
+type encoderCompiler struct {
+	named map[string]*valueEncoder
+}
+
+func newEncoderCompiler() *encoderCompiler {
+	return &encoderCompiler{named: map[string]*valueEncoder{}}
+}
+
+func (c *encoderCompiler) compile(schema avro.Schema) valueEncoder {
+	if schema.Type() == avro.Ref {
+		schema = derefSchema(schema)
+	}
+	named, isNamed := schema.(avro.NamedSchema)
+	if isNamed {
+		if enc, ok := c.named[named.FullName()]; ok {
+			// the encoder may still be compiling
+			return func(buf []byte, value interface{}) ([]byte, error) { return (*enc)(buf, value) }
+		}
+		c.named[named.FullName()] = new(valueEncoder)
+	}
+	enc := c.compileType(schema)
+	if isNamed {
+		*c.named[named.FullName()] = enc
+	}
+	return enc
+}
+
+func (c *encoderCompiler) compileType(schema avro.Schema) valueEncoder {
+	switch s := schema.(type) {
+	case *avro.RecordSchema:
+		return c.compileRecord(s)
+	case *avro.ArraySchema:
+		items := c.compile(s.Items())
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			array, ok := value.([]interface{})
+			if !ok && value != nil {
+				return buf, invalidValue(value, schema)
+			}
+			if len(array) > 0 {
+				buf = appendLong(buf, int64(len(array)))
+			}
+			var err error
+			for _, v := range array {
+				if buf, err = items(buf, v); err != nil {
+					return buf, err
+				}
+			}
+			return append(buf, 0), nil
+		}
+	case *avro.MapSchema:
+		values := c.compile(s.Values())
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			m, ok := value.(map[string]interface{})
+			if !ok && value != nil {
+				return buf, invalidValue(value, schema)
+			}
+			if len(m) > 0 {
+				buf = appendLong(buf, int64(len(m)))
+			}
+			// sort the keys to always encode the map in the same way
+			keys := make([]string, 0, len(m))
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			var err error
+			for _, k := range keys {
+				buf = appendString(buf, k)
+				if buf, err = values(buf, m[k]); err != nil {
+					return buf, err
+				}
+			}
+			return append(buf, 0), nil
+		}
+	case *avro.UnionSchema:
+		return c.compileUnion(s)
+	case *avro.EnumSchema:
+		symbols := map[string]int64{}
+		for i, symbol := range s.Symbols() {
+			symbols[symbol] = int64(i)
+		}
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			symbol, ok := value.(string)
+			index, found := symbols[symbol]
+			if !ok || !found {
+				return buf, fmt.Errorf("unknown symbol %v of the enum %s", value, s.FullName())
+			}
+			return appendLong(buf, index), nil
+		}
+	case *avro.FixedSchema:
+		return compileFixed(s)
+	}
+	return compilePrimitive(schema)
+}
+
+func (c *encoderCompiler) compileRecord(schema *avro.RecordSchema) valueEncoder {
+	fields := schema.Fields()
+	encoders := make([]valueEncoder, len(fields))
+	for i, f := range fields {
+		encoders[i] = c.compile(f.Type())
+	}
+	return func(buf []byte, value interface{}) ([]byte, error) {
+		record, ok := value.(map[string]interface{})
+		if !ok {
+			return buf, invalidValue(value, schema)
+		}
+		var err error
+		for i, f := range fields {
+			if buf, err = encoders[i](buf, record[f.Name()]); err != nil {
+				return buf, fmt.Errorf("%s.%s: %s", schema.Name(), f.Name(), err.Error())
+			}
+		}
+		return buf, nil
+	}
+}
+
+// the values of the unions are either wrapped into a map with
+// the name of the type as key, or are primitives used as they are
+func (c *encoderCompiler) compileUnion(schema *avro.UnionSchema) valueEncoder {
+	types := schema.Types()
+	encoders := make([]valueEncoder, len(types))
+	wrapped := map[string]int{}
+	nullIndex := -1
+	for i, t := range types {
+		encoders[i] = c.compile(t)
+		if name, ok := unionTypeName(t); ok {
+			wrapped[name] = i
+		}
+		if t.Type() == avro.Null {
+			nullIndex = i
+		}
+	}
+	return func(buf []byte, value interface{}) ([]byte, error) {
+		if value == nil {
+			if nullIndex < 0 {
+				return buf, invalidValue(value, schema)
+			}
+			return appendLong(buf, int64(nullIndex)), nil
+		}
+		if m, ok := value.(map[string]interface{}); ok && len(m) == 1 {
+			for name, v := range m {
+				if i, ok := wrapped[name]; ok {
+					return encoders[i](appendLong(buf, int64(i)), v)
+				}
+			}
+		}
+		for i, t := range types {
+			if _, isWrapped := unionTypeName(t); !isWrapped && acceptsPrimitive(t.Type(), value) {
+				return encoders[i](appendLong(buf, int64(i)), value)
+			}
+		}
+		// the floats are widened to the double branch
+		// when the union doesn't have a float branch
+		if _, ok := value.(float32); ok {
+			for i, t := range types {
+				if t.Type() == avro.Double && getLogicalType(t) == "" {
+					return encoders[i](appendLong(buf, int64(i)), value)
+				}
+			}
+		}
+		// the logical types accept the values of the underlying type
+		for i, t := range types {
+			if _, isNamed := derefSchema(t).(avro.NamedSchema); !isNamed && getLogicalType(t) != "" && acceptsPrimitive(t.Type(), value) {
+				return encoders[i](appendLong(buf, int64(i)), value)
+			}
+		}
+		return buf, invalidValue(value, schema)
+	}
+}
+
+// return true if the value can be used as it is for the type of the union
+func acceptsPrimitive(t avro.Type, value interface{}) bool {
+	switch value.(type) {
+	case bool:
+		return t == avro.Boolean
+	case int, int32:
+		return t == avro.Int
+	case int64:
+		return t == avro.Long
+	case float32:
+		return t == avro.Float
+	case float64:
+		return t == avro.Double
+	case string:
+		return t == avro.String
+	case []byte:
+		return t == avro.Bytes
+	}
+	return false
+}
+
+func compileFixed(schema *avro.FixedSchema) valueEncoder {
+	size := schema.Size()
+	decimal, isDecimal := schema.Logical().(*avro.DecimalLogicalSchema)
+	return func(buf []byte, value interface{}) ([]byte, error) {
+		switch v := value.(type) {
+		case []byte:
+			if len(v) != size {
+				return buf, fmt.Errorf("the fixed %s requires %d bytes, %d generated", schema.FullName(), size, len(v))
+			}
+			return append(buf, v...), nil
+		case *big.Rat:
+			if isDecimal {
+				return appendFixedDecimal(buf, v, decimal.Scale(), size), nil
+			}
+		}
+		// arrays of the fixed size
+		rv := reflect.ValueOf(value)
+		if rv.Kind() != reflect.Array || rv.Len() != size || rv.Type().Elem().Kind() != reflect.Uint8 {
+			return buf, invalidValue(value, schema)
+		}
+		for i := 0; i < size; i++ {
+			buf = append(buf, byte(rv.Index(i).Uint()))
+		}
+		return buf, nil
+	}
+}
+
+func compilePrimitive(schema avro.Schema) valueEncoder {
+	logicalType := getLogicalType(schema)
+	switch schema.Type() {
+	case avro.Null:
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			if value != nil {
+				return buf, invalidValue(value, schema)
+			}
+			return buf, nil
+		}
+	case avro.Boolean:
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			v, ok := value.(bool)
+			if !ok {
+				return buf, invalidValue(value, schema)
+			}
+			if v {
+				return append(buf, 1), nil
+			}
+			return append(buf, 0), nil
+		}
+	case avro.Int:
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			switch v := value.(type) {
+			case int:
+				if v < math.MinInt32 || v > math.MaxInt32 {
+					return buf, fmt.Errorf("the value %d is out of the range of the int type", v)
+				}
+				return appendLong(buf, int64(v)), nil
+			case int32:
+				return appendLong(buf, int64(v)), nil
+			case time.Time:
+				if logicalType == avro.Date {
+					return appendLong(buf, v.Unix()/int64(24*time.Hour/time.Second)), nil
+				}
+			case time.Duration:
+				if logicalType == avro.TimeMillis {
+					return appendLong(buf, int64(int32(v.Nanoseconds()/int64(time.Millisecond)))), nil
+				}
+			}
+			return buf, invalidValue(value, schema)
+		}
+	case avro.Long:
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			switch v := value.(type) {
+			case int64:
+				return appendLong(buf, v), nil
+			case int:
+				return appendLong(buf, int64(v)), nil
+			case time.Time:
+				if logicalType == avro.TimestampMillis {
+					return appendLong(buf, v.Unix()*1e3+int64(v.Nanosecond()/1e6)), nil
+				}
+				if logicalType == avro.TimestampMicros {
+					return appendLong(buf, v.Unix()*1e6+int64(v.Nanosecond()/1e3)), nil
+				}
+			case time.Duration:
+				if logicalType == avro.TimeMicros {
+					return appendLong(buf, v.Nanoseconds()/int64(time.Microsecond)), nil
+				}
+			}
+			return buf, invalidValue(value, schema)
+		}
+	case avro.Float:
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			v, ok := value.(float32)
+			if !ok {
+				return buf, invalidValue(value, schema)
+			}
+			return appendUint32(buf, math.Float32bits(v)), nil
+		}
+	case avro.Double:
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			switch v := value.(type) {
+			case float64:
+				return appendUint64(buf, math.Float64bits(v)), nil
+			case float32:
+				return appendUint64(buf, math.Float64bits(float64(v))), nil
+			}
+			return buf, invalidValue(value, schema)
+		}
+	case avro.String:
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			v, ok := value.(string)
+			if !ok {
+				return buf, invalidValue(value, schema)
+			}
+			return appendString(buf, v), nil
+		}
+	case avro.Bytes:
+		var scale int
+		if decimal, ok := schema.(avro.LogicalTypeSchema).Logical().(*avro.DecimalLogicalSchema); ok {
+			scale = decimal.Scale()
+		}
+		return func(buf []byte, value interface{}) ([]byte, error) {
+			switch v := value.(type) {
+			case []byte:
+				return appendBytes(buf, v), nil
+			case *big.Rat:
+				if logicalType == avro.Decimal {
+					return appendBytes(buf, decimalBytes(v, scale)), nil
+				}
+			}
+			return buf, invalidValue(value, schema)
+		}
+	}
+	return func(buf []byte, value interface{}) ([]byte, error) {
+		return buf, fmt.Errorf("unsupported type %s", schema.Type())
+	}
+}
+
+func invalidValue(value interface{}, schema avro.Schema) error {
+	schemas := []pathSchema{{schema: schema}}
+	// describe the types of the unions
+	if union, ok := derefSchema(schema).(*avro.UnionSchema); ok {
+		for _, t := range union.Types() {
+			schemas = append(schemas, pathSchema{schema: t, inUnion: true})
+		}
+	}
+	return fmt.Errorf("unable to encode the value %v (%T) as %s", value, value, describeTypes(schemas))
+}
+
+// append the zig-zag variable length encoding of the long
+func appendLong(buf []byte, value int64) []byte {
+	u := uint64((value << 1) ^ (value >> 63))
+	for u >= 0x80 {
+		buf = append(buf, byte(u)|0x80)
+		u >>= 7
+	}
+	return append(buf, byte(u))
+}
+
+// little-endian encodings of the floats
+func appendUint32(buf []byte, value uint32) []byte {
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], value)
+	return append(buf, b[:]...)
+}
+
+func appendUint64(buf []byte, value uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], value)
+	return append(buf, b[:]...)
+}
+
+func appendString(buf []byte, value string) []byte {
+	return append(appendLong(buf, int64(len(value))), value...)
+}
+
+func appendBytes(buf []byte, value []byte) []byte {
+	return append(appendLong(buf, int64(len(value))), value...)
+}
+
+// unscaled value of the decimal in big-endian two's complement
+func decimalBytes(value *big.Rat, scale int) []byte {
+	i := new(big.Int).Mul(value.Num(), new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+	i = i.Div(i, value.Denom())
+	switch i.Sign() {
+	case 0:
+		return []byte{0}
+	case 1:
+		b := i.Bytes()
+		if b[0]&0x80 > 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b
+	default:
+		length := uint(i.BitLen()/8+1) * 8
+		return i.Add(i, new(big.Int).Lsh(big.NewInt(1), length)).Bytes()
+	}
+}
+
+// decimal padded to the size of the fixed, preserving the sign
+func appendFixedDecimal(buf []byte, value *big.Rat, scale int, size int) []byte {
+	b := decimalBytes(value, scale)
+	padding := byte(0)
+	if value.Sign() < 0 {
+		padding = 0xff
+	}
+	for i := len(b); i < size; i++ {
+		buf = append(buf, padding)
+	}
+	return append(buf, b...)
+}
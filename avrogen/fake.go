@@ -0,0 +1,342 @@
+package avrogen
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"strings"
+)
+
+// dataset used to generate realistic fake data
+type fakeLocale struct {
+	firstNames     []string
+	lastNames      []string
+	streets        []string
+	streetSuffixes []string
+	cities         []string
+	// country code used to generate the iban
+	ibanCountry   string
+	emailDomains  []string
+	companySuffix []string
+	// formats of the generated values where # is replaced by
+	// a random digit and ? by a random uppercase letter
+	phoneFormats    []string
+	postcodeFormats []string
+	// format of the street address where %[1]s is the number,
+	// %[2]s the street name and %[3]s the street suffix
+	addressFormat string
+}
+
+// datasets available for the fake data generators
+var fakeLocales = map[string]*fakeLocale{
+	"en_US": &enUSLocale,
+	"en_GB": &enGBLocale,
+	"it_IT": &itITLocale,
+	"de_DE": &deDELocale,
+}
+
+// return the locale with the provided name, e.g. it_IT
+func getFakeLocale(name string) (*fakeLocale, error) {
+	locale, ok := fakeLocales[strings.ReplaceAll(name, "-", "_")]
+	if !ok {
+		return nil, fmt.Errorf("unsupported locale %s", name)
+	}
+	return locale, nil
+}
+
+var enUSLocale = fakeLocale{
+	firstNames: []string{
+		"Mary", "James", "Patricia", "Robert", "Jennifer", "John", "Linda", "Michael", "Elizabeth", "William",
+		"Barbara", "David", "Susan", "Richard", "Jessica", "Joseph", "Sarah", "Thomas", "Karen", "Charles",
+		"Nancy", "Christopher", "Lisa", "Daniel", "Betty", "Matthew", "Margaret", "Anthony", "Sandra", "Mark",
+		"Ashley", "Donald", "Kimberly", "Steven", "Emily", "Paul", "Donna", "Andrew", "Michelle", "Joshua",
+	},
+	lastNames: []string{
+		"Smith", "Johnson", "Williams", "Brown", "Jones", "Garcia", "Miller", "Davis", "Rodriguez", "Martinez",
+		"Hernandez", "Lopez", "Gonzalez", "Wilson", "Anderson", "Thomas", "Taylor", "Moore", "Jackson", "Martin",
+		"Lee", "Perez", "Thompson", "White", "Harris", "Sanchez", "Clark", "Ramirez", "Lewis", "Robinson",
+		"Walker", "Young", "Allen", "King", "Wright", "Scott", "Torres", "Nguyen", "Hill", "Flores",
+	},
+	streets: []string{
+		"Main", "Oak", "Pine", "Maple", "Cedar", "Elm", "Washington", "Lake", "Hill", "Park",
+		"Walnut", "Sunset", "Lincoln", "Jackson", "Church", "River", "Spring", "Highland", "Meadow", "Forest",
+	},
+	streetSuffixes: []string{"Street", "Avenue", "Road", "Boulevard", "Lane", "Drive", "Court", "Place"},
+	cities: []string{
+		"New York", "Los Angeles", "Chicago", "Houston", "Phoenix", "Philadelphia", "San Antonio", "San Diego",
+		"Dallas", "San Jose", "Austin", "Jacksonville", "Fort Worth", "Columbus", "Charlotte", "Indianapolis",
+		"San Francisco", "Seattle", "Denver", "Boston", "Nashville", "Portland", "Las Vegas", "Detroit",
+	},
+	ibanCountry:     "GB",
+	emailDomains:    []string{"example.com", "example.org", "example.net", "mail.com", "test.com"},
+	companySuffix:   []string{"Inc", "LLC", "Group", "Corp", "& Sons", "Holdings", "Partners"},
+	phoneFormats:    []string{"+1 (###) ###-####", "###-###-####"},
+	postcodeFormats: []string{"#####"},
+	addressFormat:   "%[1]s %[2]s %[3]s",
+}
+
+var enGBLocale = fakeLocale{
+	firstNames: []string{
+		"Oliver", "George", "Harry", "Jack", "Jacob", "Noah", "Charlie", "Muhammad", "Thomas", "Oscar",
+		"William", "James", "Henry", "Leo", "Alfie", "Joshua", "Freddie", "Archie", "Ethan", "Isaac",
+		"Olivia", "Amelia", "Isla", "Ava", "Emily", "Isabella", "Mia", "Poppy", "Ella", "Lily",
+		"Jessica", "Sophie", "Grace", "Evie", "Ruby", "Charlotte", "Florence", "Alice", "Freya", "Daisy",
+	},
+	lastNames: []string{
+		"Smith", "Jones", "Williams", "Taylor", "Brown", "Davies", "Evans", "Wilson", "Thomas", "Johnson",
+		"Roberts", "Robinson", "Thompson", "Wright", "Walker", "White", "Edwards", "Hughes", "Green", "Hall",
+		"Lewis", "Harris", "Clarke", "Patel", "Jackson", "Wood", "Turner", "Martin", "Cooper", "Hill",
+	},
+	streets: []string{
+		"High", "Station", "Church", "Victoria", "Park", "London", "Green", "Manor", "Kings", "Queens",
+		"Mill", "Albert", "Windsor", "York", "New", "School", "North", "Grange", "Springfield", "Chester",
+	},
+	streetSuffixes: []string{"Street", "Road", "Lane", "Close", "Avenue", "Drive", "Way", "Gardens", "Crescent"},
+	cities: []string{
+		"London", "Birmingham", "Manchester", "Leeds", "Glasgow", "Liverpool", "Bristol", "Sheffield",
+		"Edinburgh", "Cardiff", "Leicester", "Nottingham", "Newcastle", "Brighton", "Southampton", "Oxford",
+		"Cambridge", "York", "Belfast", "Aberdeen",
+	},
+	ibanCountry:     "GB",
+	emailDomains:    []string{"example.co.uk", "example.com", "example.org", "mail.co.uk"},
+	companySuffix:   []string{"Ltd", "PLC", "LLP", "& Co", "Group"},
+	phoneFormats:    []string{"+44 7### ######", "07### ######", "+44 20 #### ####"},
+	postcodeFormats: []string{"?# #??", "?## #??", "??# #??", "??## #??"},
+	addressFormat:   "%[1]s %[2]s %[3]s",
+}
+
+var itITLocale = fakeLocale{
+	firstNames: []string{
+		"Giuseppe", "Giovanni", "Antonio", "Mario", "Luigi", "Francesco", "Angelo", "Vincenzo", "Pietro", "Salvatore",
+		"Carlo", "Franco", "Domenico", "Bruno", "Paolo", "Michele", "Giorgio", "Aldo", "Sergio", "Luca",
+		"Maria", "Anna", "Giuseppina", "Rosa", "Angela", "Giovanna", "Teresa", "Lucia", "Carmela", "Caterina",
+		"Francesca", "Giulia", "Chiara", "Sara", "Martina", "Valentina", "Alessandra", "Elena", "Silvia", "Laura",
+	},
+	lastNames: []string{
+		"Rossi", "Russo", "Ferrari", "Esposito", "Bianchi", "Romano", "Colombo", "Ricci", "Marino", "Greco",
+		"Bruno", "Gallo", "Conti", "De Luca", "Mancini", "Costa", "Giordano", "Rizzo", "Lombardi", "Moretti",
+		"Barbieri", "Fontana", "Santoro", "Mariani", "Rinaldi", "Caruso", "Ferrara", "Galli", "Martini", "Leone",
+	},
+	streets: []string{
+		"Roma", "Garibaldi", "Mazzini", "Dante", "Cavour", "Verdi", "Marconi", "Matteotti", "Vittorio Emanuele",
+		"della Repubblica", "dei Mille", "XX Settembre", "IV Novembre", "Nazionale", "del Corso", "San Francesco",
+	},
+	streetSuffixes: []string{"Via", "Viale", "Piazza", "Corso", "Vicolo", "Largo"},
+	cities: []string{
+		"Roma", "Milano", "Napoli", "Torino", "Palermo", "Genova", "Bologna", "Firenze", "Bari", "Catania",
+		"Venezia", "Verona", "Messina", "Padova", "Trieste", "Brescia", "Parma", "Taranto", "Prato", "Modena",
+	},
+	ibanCountry:     "IT",
+	emailDomains:    []string{"example.it", "example.com", "posta.it", "mail.it"},
+	companySuffix:   []string{"S.p.A.", "S.r.l.", "S.n.c.", "S.a.s."},
+	phoneFormats:    []string{"+39 3## ### ####", "3## ### ####", "+39 0# #### ####"},
+	postcodeFormats: []string{"#####"},
+	addressFormat:   "%[3]s %[2]s, %[1]s",
+}
+
+var deDELocale = fakeLocale{
+	firstNames: []string{
+		"Peter", "Michael", "Thomas", "Andreas", "Wolfgang", "Klaus", "Jürgen", "Stefan", "Christian", "Uwe",
+		"Werner", "Frank", "Bernd", "Markus", "Matthias", "Lukas", "Jonas", "Leon", "Finn", "Felix",
+		"Ursula", "Monika", "Petra", "Sabine", "Renate", "Helga", "Karin", "Brigitte", "Ingrid", "Andrea",
+		"Anna", "Lena", "Lea", "Hannah", "Sophie", "Marie", "Julia", "Laura", "Katharina", "Sarah",
+	},
+	lastNames: []string{
+		"Müller", "Schmidt", "Schneider", "Fischer", "Weber", "Meyer", "Wagner", "Becker", "Schulz", "Hoffmann",
+		"Schäfer", "Koch", "Bauer", "Richter", "Klein", "Wolf", "Schröder", "Neumann", "Schwarz", "Zimmermann",
+		"Braun", "Krüger", "Hofmann", "Hartmann", "Lange", "Schmitt", "Werner", "Schmitz", "Krause", "Meier",
+	},
+	streets: []string{
+		"Haupt", "Schul", "Garten", "Bahnhof", "Dorf", "Berg", "Kirch", "Wald", "Ring", "Linden",
+		"Goethe", "Schiller", "Mozart", "Friedhof", "Feld", "Birken", "Rosen", "Sonnen", "Wiesen", "Buchen",
+	},
+	streetSuffixes: []string{"straße", "weg", "allee", "gasse", "platz"},
+	cities: []string{
+		"Berlin", "Hamburg", "München", "Köln", "Frankfurt am Main", "Stuttgart", "Düsseldorf", "Leipzig",
+		"Dortmund", "Essen", "Bremen", "Dresden", "Hannover", "Nürnberg", "Duisburg", "Bochum", "Wuppertal",
+		"Bielefeld", "Bonn", "Münster",
+	},
+	ibanCountry:     "DE",
+	emailDomains:    []string{"example.de", "example.com", "mail.de", "post.de"},
+	companySuffix:   []string{"GmbH", "AG", "KG", "GmbH & Co. KG", "OHG"},
+	phoneFormats:    []string{"+49 15# ########", "+49 17# #######", "+49 30 ########", "0### #######"},
+	postcodeFormats: []string{"#####"},
+	addressFormat:   "%[2]s%[3]s %[1]s",
+}
+
+var countries = []string{
+	"Argentina", "Australia", "Austria", "Belgium", "Brazil", "Canada", "Chile", "China", "Colombia", "Czech Republic",
+	"Denmark", "Egypt", "Finland", "France", "Germany", "Greece", "Hungary", "India", "Indonesia", "Ireland",
+	"Israel", "Italy", "Japan", "Kenya", "Mexico", "Netherlands", "New Zealand", "Nigeria", "Norway", "Poland",
+	"Portugal", "Romania", "Singapore", "South Africa", "South Korea", "Spain", "Sweden", "Switzerland", "Turkey",
+	"United Kingdom", "United States",
+}
+
+var companyNames = []string{
+	"Acme", "Globex", "Initech", "Umbrella", "Stark", "Wayne", "Wonka", "Cyberdyne", "Soylent", "Tyrell",
+	"Vandelay", "Hooli", "Massive Dynamic", "Oscorp", "Aperture", "Gringotts", "Monarch", "Dunder Mifflin",
+}
+
+// structure of the BBAN (the part of the iban after the check digits)
+// where `a` is an uppercase letter, `n` a digit and `c` a letter or a digit
+var ibanFormats = map[string]string{
+	"GB": "aaaannnnnnnnnnnnnn",
+	"DE": "nnnnnnnnnnnnnnnnnn",
+	"IT": "annnnnnnnnncccccccccccc",
+	"FR": "nnnnnnnnnnnnnnnnnnnnnnn",
+	"ES": "nnnnnnnnnnnnnnnnnnnn",
+	"NL": "aaaannnnnnnnnn",
+}
+
+// prefixes and length of the credit card numbers
+var creditCardFormats = []struct {
+	prefixes []string
+	length   int
+}{
+	{prefixes: []string{"4"}, length: 16},                          // visa
+	{prefixes: []string{"51", "52", "53", "54", "55"}, length: 16}, // mastercard
+	{prefixes: []string{"34", "37"}, length: 15},                   // american express
+}
+
+// parse the functions that generate fake data
+// returns nil if the function or its arguments are invalid
+func parseFakeFunction(function string, args []string, state *generatorState) func() []string {
+	locale := state.locale
+	random := state.random
+	var gen func() string
+	switch function {
+	case "first_name":
+		gen = func() string { return pick(random, locale.firstNames) }
+	case "last_name":
+		gen = func() string { return pick(random, locale.lastNames) }
+	case "full_name":
+		gen = func() string { return pick(random, locale.firstNames) + " " + pick(random, locale.lastNames) }
+	case "email":
+		gen = func() string {
+			return fmt.Sprintf("%s.%s%d@%s",
+				toEmailName(pick(random, locale.firstNames)),
+				toEmailName(pick(random, locale.lastNames)),
+				random.Intn(100),
+				pick(random, locale.emailDomains))
+		}
+	case "street_address":
+		gen = func() string {
+			return fmt.Sprintf(locale.addressFormat,
+				fmt.Sprint(1+random.Intn(9999)),
+				pick(random, locale.streets),
+				pick(random, locale.streetSuffixes))
+		}
+	case "city":
+		gen = func() string { return pick(random, locale.cities) }
+	case "postcode":
+		gen = func() string { return replacePlaceholders(random, pick(random, locale.postcodeFormats)) }
+	case "country":
+		gen = func() string { return pick(random, countries) }
+	case "phone_number":
+		gen = func() string { return replacePlaceholders(random, pick(random, locale.phoneFormats)) }
+	case "company":
+		gen = func() string { return pick(random, companyNames) + " " + pick(random, locale.companySuffix) }
+	case "iban":
+		country := locale.ibanCountry
+		if len(args) == 1 {
+			country = strings.ToUpper(args[0])
+		}
+		if _, ok := ibanFormats[country]; !ok {
+			return nil
+		}
+		gen = func() string { return generateIban(random, country) }
+	case "credit_card":
+		gen = func() string { return generateCreditCard(random) }
+	default:
+		return nil
+	}
+	// only the iban accepts an argument
+	if len(args) > 0 && !(function == "iban" && len(args) == 1) {
+		return nil
+	}
+	return func() []string { return []string{gen()} }
+}
+
+func pick(random *rand.Rand, values []string) string {
+	return values[random.Intn(len(values))]
+}
+
+// replace each # in the format with a random digit
+// and each ? with a random uppercase letter
+func replacePlaceholders(random *rand.Rand, format string) string {
+	var res strings.Builder
+	for _, c := range format {
+		switch c {
+		case '#':
+			res.WriteByte(byte('0' + random.Intn(10)))
+		case '?':
+			res.WriteByte(byte('A' + random.Intn(26)))
+		default:
+			res.WriteRune(c)
+		}
+	}
+	return res.String()
+}
+
+// lower case ascii version of the name to use in emails
+func toEmailName(name string) string {
+	return strings.NewReplacer(
+		"ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", " ", "",
+	).Replace(strings.ToLower(name))
+}
+
+func generateIban(random *rand.Rand, country string) string {
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	const alphanumeric = letters + "0123456789"
+	var bban strings.Builder
+	for _, c := range ibanFormats[country] {
+		switch c {
+		case 'a':
+			bban.WriteByte(letters[random.Intn(len(letters))])
+		case 'n':
+			bban.WriteByte(byte('0' + random.Intn(10)))
+		case 'c':
+			bban.WriteByte(alphanumeric[random.Intn(len(alphanumeric))])
+		}
+	}
+	// the check digits are computed with the mod 97 of the number obtained
+	// moving the country code at the end and replacing letters with numbers
+	var numeric strings.Builder
+	for _, c := range bban.String() + country + "00" {
+		if c >= 'A' && c <= 'Z' {
+			numeric.WriteString(fmt.Sprint(c - 'A' + 10))
+		} else {
+			numeric.WriteRune(c)
+		}
+	}
+	value, _ := new(big.Int).SetString(numeric.String(), 10)
+	check := 98 - new(big.Int).Mod(value, big.NewInt(97)).Int64()
+	return fmt.Sprintf("%s%02d%s", country, check, bban.String())
+}
+
+func generateCreditCard(random *rand.Rand) string {
+	format := creditCardFormats[random.Intn(len(creditCardFormats))]
+	number := []byte(pick(random, format.prefixes))
+	for len(number) < format.length-1 {
+		number = append(number, byte('0'+random.Intn(10)))
+	}
+	return string(append(number, luhnCheckDigit(number)))
+}
+
+// compute the digit that makes the number valid
+// accordingly to the Luhn algorithm
+func luhnCheckDigit(number []byte) byte {
+	sum := 0
+	for i := len(number) - 1; i >= 0; i-- {
+		digit := int(number[i] - '0')
+		// double every other digit starting from the rightmost
+		if (len(number)-1-i)%2 == 0 {
+			digit *= 2
+			if digit > 9 {
+				digit -= 9
+			}
+		}
+		sum += digit
+	}
+	return byte('0' + (10-sum%10)%10)
+}
@@ -0,0 +1,133 @@
+package avrogen
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func isValidLuhn(number string) bool {
+	return luhnCheckDigit([]byte(number[:len(number)-1])) == number[len(number)-1]
+}
+
+func isValidIban(iban string) bool {
+	var numeric strings.Builder
+	for _, c := range iban[4:] + iban[:4] {
+		if c >= 'A' && c <= 'Z' {
+			numeric.WriteString(fmt.Sprint(c - 'A' + 10))
+		} else {
+			numeric.WriteRune(c)
+		}
+	}
+	value, _ := new(big.Int).SetString(numeric.String(), 10)
+	return new(big.Int).Mod(value, big.NewInt(97)).Int64() == 1
+}
+
+func TestLuhnCheckDigit(t *testing.T) {
+	// well known valid test numbers
+	for _, n := range []string{"4111111111111111", "5555555555554444", "378282246310005"} {
+		if !isValidLuhn(n) {
+			t.Errorf("%s should be valid", n)
+		}
+	}
+}
+
+func TestHappyPathGenerateFakeData(t *testing.T) {
+	state := newGeneratorState(0)
+	emailRegex := regexp.MustCompile(`^[a-z]+\.[a-z]+[0-9]*@[a-z]+\.[a-z]+$`)
+	for i := 0; i < 100; i++ {
+		res, _ := mustNewFieldGen("{string}[email()]{1}", state)()
+		if !emailRegex.MatchString(res.(string)) {
+			t.Errorf("invalid email %s", res)
+		}
+		res, _ = mustNewFieldGen("{string}[credit_card()]{1}", state)()
+		if !isValidLuhn(res.(string)) {
+			t.Errorf("invalid credit card %s", res)
+		}
+		res, _ = mustNewFieldGen("{string}[iban()]{1}", state)()
+		if !isValidIban(res.(string)) {
+			t.Errorf("invalid iban %s", res)
+		}
+		res, _ = mustNewFieldGen("{string}[iban(IT)]{1}", state)()
+		if !isValidIban(res.(string)) || res.(string)[:2] != "IT" || len(res.(string)) != 27 {
+			t.Errorf("invalid iban %s", res)
+		}
+	}
+	for _, f := range []string{
+		"first_name()", "last_name()", "full_name()", "street_address()", "city()",
+		"postcode()", "country()", "phone_number()", "company()",
+	} {
+		res, err := mustNewFieldGen("{string}["+f+"]{1}", state)()
+		if err != nil || res == "" {
+			t.Errorf("unable to generate %s", f)
+		}
+	}
+}
+
+func TestFakeDataIsReproducible(t *testing.T) {
+	gen1 := mustNewFieldGen("{string}[full_name()]{1}[ - ]{1}[street_address()]{1}", newGeneratorState(42))
+	gen2 := mustNewFieldGen("{string}[full_name()]{1}[ - ]{1}[street_address()]{1}", newGeneratorState(42))
+	for i := 0; i < 10; i++ {
+		res1, _ := gen1()
+		res2, _ := gen2()
+		if res1 != res2 {
+			t.Errorf("expected the same value with the same seed, %s != %s", res1, res2)
+		}
+	}
+}
+
+func TestParseInvalidFakeFunctions(t *testing.T) {
+	state := newGeneratorState(0)
+	for _, p := range []string{
+		"{string}[iban(XX)]{1}",
+		"{string}[iban(IT,DE)]{1}",
+		"{string}[email(test)]{1}",
+	} {
+		if _, err := parsePattern(p, state); err == nil {
+			t.Errorf("the pattern %s should be invalid", p)
+		}
+	}
+}
+
+func TestHappyPathGenerateLocalizedFakeData(t *testing.T) {
+	for _, tc := range []struct {
+		locale   string
+		postcode *regexp.Regexp
+		phone    *regexp.Regexp
+		iban     string
+	}{
+		{"en_US", regexp.MustCompile(`^\d{5}$`), regexp.MustCompile(`^(\+1 )?\(?\d{3}\)?[ -]\d{3}-\d{4}$`), "GB"},
+		{"en_GB", regexp.MustCompile(`^[A-Z]{1,2}\d{1,2} \d[A-Z]{2}$`), regexp.MustCompile(`^(\+44 |0)[0-9 ]+$`), "GB"},
+		{"it_IT", regexp.MustCompile(`^\d{5}$`), regexp.MustCompile(`^(\+39 )?[03][0-9 ]+$`), "IT"},
+		{"de-DE", regexp.MustCompile(`^\d{5}$`), regexp.MustCompile(`^(\+49 |0)[0-9 ]+$`), "DE"},
+	} {
+		locale, err := getFakeLocale(tc.locale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		state := newGeneratorState(0).withLocale(locale)
+		for i := 0; i < 20; i++ {
+			res, _ := mustNewFieldGen("{string}[postcode()]{1}", state)()
+			if !tc.postcode.MatchString(res.(string)) {
+				t.Errorf("invalid %s postcode %s", tc.locale, res)
+			}
+			res, _ = mustNewFieldGen("{string}[phone_number()]{1}", state)()
+			if !tc.phone.MatchString(res.(string)) {
+				t.Errorf("invalid %s phone number %s", tc.locale, res)
+			}
+			res, _ = mustNewFieldGen("{string}[iban()]{1}", state)()
+			if !isValidIban(res.(string)) || res.(string)[:2] != tc.iban {
+				t.Errorf("invalid %s iban %s", tc.locale, res)
+			}
+			res, _ = mustNewFieldGen("{string}[email()]{1}", state)()
+			if !regexp.MustCompile(`^[a-z]+\.[a-z]+[0-9]*@[a-z.]+$`).MatchString(res.(string)) {
+				t.Errorf("invalid %s email %s", tc.locale, res)
+			}
+		}
+	}
+	if _, err := getFakeLocale("xx_XX"); err == nil {
+		t.Error("expected an error for an unsupported locale")
+	}
+}
@@ -3,7 +3,9 @@ package avrogen
 import (
 	"fmt"
 	"math/rand"
+	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/hamba/avro"
 )
@@ -11,63 +13,220 @@ import (
 // generic data generator
 type fieldGen func() (interface{}, error)
 
-func newFieldGen(rawPattern string, random *rand.Rand) fieldGen {
-	pattern := parsePattern(rawPattern)
-	if pattern == nil {
-		return nil
+// state shared by all the generators of a producer
+type generatorState struct {
+	// the random source is re-seeded at each
+	// record from the seed and the record index
+	seed   int64
+	random *rand.Rand
+	// the record being generated
+	record *recordState
+	// dataset used by the fake data generators
+	locale *fakeLocale
+	// clock used by the time based generators
+	clock *clock
+}
+
+type recordState struct {
+	// index of the record being generated
+	index int64
+	// key of the record being generated
+	key string
+	// records (and nested records) being generated
+	// from the root to the innermost one
+	frames []recordFrame
+	// error of the options that fail while generating
+	// the record, e.g. too many keys for sequence_by_key()
+	err error
+}
+
+type recordFrame struct {
+	path   string
+	record map[string]interface{}
+}
+
+func newGeneratorState(seed int64) *generatorState {
+	return &generatorState{
+		seed:   seed,
+		random: rand.New(&splitMixSource{state: uint64(seed)}),
+		record: &recordState{},
+		locale: &enUSLocale,
+		clock:  &clock{},
+	}
+}
+
+// prepare the state to generate the record at the index
+func (s *generatorState) startRecord(index int64) {
+	s.random.Seed(recordSeed(s.seed, index))
+	s.record.index = index
+	s.record.key = ""
+	s.record.frames = nil
+	s.record.err = nil
+}
+
+// current time of the clock for the record being generated
+func (s *generatorState) now() time.Time {
+	return s.clock.now(s.record.index)
+}
+
+// return a copy of the state that uses a different locale
+// the random source, the record and the clock are still shared
+func (s *generatorState) withLocale(locale *fakeLocale) *generatorState {
+	res := *s
+	res.locale = locale
+	return &res
+}
+
+func newFieldGen(rawPattern string, state *generatorState) (fieldGen, error) {
+	pattern, err := parsePattern(rawPattern, state)
+	if err != nil {
+		return nil, err
 	}
+	random := state.random
+	// reused by the calls to build the string
+	var res []byte
 	return func() (interface{}, error) {
 		if pattern.type_ == string(avro.Null) {
 			return nil, nil
 		}
-		var res string
+		res = res[:0]
 		for _, c := range pattern.content {
-			for i := 0; i < c.count; i++ {
+			count := c.pickCount(random)
+			for i := 0; i < count; i++ {
 				// pick a random patternIdx
-				patternIdx := random.Intn(len(c.options))
+				patternIdx := c.pickOption(random)
 				// generate the list of options for the selected
 				// pattern
 				options := c.options[patternIdx]()
 				k := random.Intn(len(options))
-				res += options[k]
+				res = append(res, options[k]...)
 			}
 		}
-		switch pattern.type_ {
-		case string(avro.Boolean):
-			return strconv.ParseBool(res)
-		case string(avro.Int):
-			return strconv.Atoi(res)
-		case string(avro.Long):
-			return strconv.ParseInt(res, 10, 64)
-		case string(avro.Float):
-			res, err := strconv.ParseFloat(res, 32)
-			if err != nil {
-				return nil, err
-			}
-			return float32(res), nil
-		case string(avro.Double):
-			return strconv.ParseFloat(res, 64)
-		case string(avro.String):
-			return res, nil
-		default:
-			return nil, fmt.Errorf("unsupported avro type %s", pattern.type_)
+		if err := state.record.err; err != nil {
+			state.record.err = nil
+			return nil, err
 		}
+		return parseValue(pattern.type_, string(res))
+	}, nil
+}
+
+// same as newFieldGen but panics if the pattern is invalid,
+// use only for the patterns known to be valid
+func mustNewFieldGen(rawPattern string, state *generatorState) fieldGen {
+	res, err := newFieldGen(rawPattern, state)
+	if err != nil {
+		panic(fmt.Sprintf("invalid pattern %s, %s", rawPattern, err.Error()))
 	}
+	return res
 }
 
-func defaultKeyGen(random *rand.Rand) fieldGen       { return newFieldGen("{string}[uuid()]{1}", random) }
-func defaultIntFieldGen(random *rand.Rand) fieldGen  { return newFieldGen("{int}[0-9]{4}", random) }
-func defaultLongFieldGen(random *rand.Rand) fieldGen { return newFieldGen("{long}[0-9]{7}", random) }
-func defaultStringFieldGen(random *rand.Rand) fieldGen {
-	return newFieldGen("{string}[a-Z|0-9]{10}", random)
+// convert the generated string into the avro type
+func parseValue(avroType string, value string) (interface{}, error) {
+	switch avroType {
+	case string(avro.Null):
+		return nil, nil
+	case string(avro.Boolean):
+		return strconv.ParseBool(value)
+	case string(avro.Int):
+		return strconv.Atoi(value)
+	case string(avro.Long):
+		return strconv.ParseInt(value, 10, 64)
+	case string(avro.Float):
+		res, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return nil, err
+		}
+		return float32(res), nil
+	case string(avro.Double):
+		return strconv.ParseFloat(value, 64)
+	case string(avro.String):
+		return value, nil
+	case string(avro.Bytes):
+		return []byte(value), nil
+	default:
+		return nil, fmt.Errorf("unsupported avro type %s", avroType)
+	}
+}
+
+func defaultKeyGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{string}[uuid()]{1}", state)
+}
+func defaultIntFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{int}[0-9]{4}", state)
+}
+func defaultLongFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{long}[0-9]{7}", state)
+}
+func defaultStringFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{string}[a-Z|0-9]{10}", state)
+}
+func defaultFloatFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{float}[0]{1}[.]{1}[0-9]{3}", state)
 }
-func defaultFloatFieldGen(random *rand.Rand) fieldGen {
-	return newFieldGen("{float}[0]{1}[.]{1}[0-9]{3}", random)
+func defaultDoubleFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{double}[0]{1}[.]{1}[0-9]{3}", state)
 }
-func defaultDoubleFieldGen(random *rand.Rand) fieldGen {
-	return newFieldGen("{double}[0]{1}[.]{1}[0-9]{3}", random)
+func defaultBooleanFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{boolean}[true|false]{1}", state)
 }
-func defaultBooleanFieldGen(random *rand.Rand) fieldGen {
-	return newFieldGen("{boolean}[true|false]{1}", random)
+func defaultBytesFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{bytes}[random_bytes(1,16)]{1}", state)
 }
 func defaultNullFieldGen() fieldGen { return func() (interface{}, error) { return nil, nil } }
+
+// window used by the default date and timestamp generators
+const defaultTimeWindow = 30 * 24 * time.Hour
+
+// timestamp in the last 30 days (used for both timestamp-millis and timestamp-micros)
+func defaultTimestampFieldGen(state *generatorState) fieldGen {
+	return func() (interface{}, error) {
+		offset := time.Duration(state.random.Int63n(int64(defaultTimeWindow)))
+		return state.now().Add(-offset).UTC(), nil
+	}
+}
+
+// date in the last 30 days
+func defaultDateFieldGen(state *generatorState) fieldGen {
+	return func() (interface{}, error) {
+		offset := time.Duration(state.random.Int63n(int64(defaultTimeWindow)))
+		return state.now().Add(-offset).UTC().Truncate(24 * time.Hour), nil
+	}
+}
+
+// time of the day with millisecond precision
+func defaultTimeMillisFieldGen(state *generatorState) fieldGen {
+	return func() (interface{}, error) {
+		return time.Duration(state.random.Int63n(int64(24*time.Hour/time.Millisecond))) * time.Millisecond, nil
+	}
+}
+
+// time of the day with microsecond precision
+func defaultTimeMicrosFieldGen(state *generatorState) fieldGen {
+	return func() (interface{}, error) {
+		return time.Duration(state.random.Int63n(int64(24*time.Hour/time.Microsecond))) * time.Microsecond, nil
+	}
+}
+
+func defaultUUIDFieldGen(state *generatorState) fieldGen {
+	return mustNewFieldGen("{string}[uuid()]{1}", state)
+}
+
+// random bytes of the size required by the fixed schema
+func defaultFixedFieldGen(schema *avro.FixedSchema, state *generatorState) fieldGen {
+	return func() (interface{}, error) {
+		res := make([]byte, schema.Size())
+		state.random.Read(res)
+		return toFixed(res, schema)
+	}
+}
+
+// convert the slice into an array with the size of the
+// fixed schema, as required to marshal a fixed type
+func toFixed(value []byte, schema *avro.FixedSchema) (interface{}, error) {
+	if len(value) != schema.Size() {
+		return nil, fmt.Errorf("the fixed %s requires %d bytes, %d generated", schema.FullName(), schema.Size(), len(value))
+	}
+	res := reflect.New(reflect.ArrayOf(schema.Size(), reflect.TypeOf(byte(0)))).Elem()
+	reflect.Copy(res, reflect.ValueOf(value))
+	return res.Interface(), nil
+}
@@ -2,7 +2,7 @@ package avrogen
 
 import (
 	"fmt"
-	"math/rand"
+	"strings"
 	"testing"
 	"unicode"
 
@@ -10,43 +10,43 @@ import (
 )
 
 func TestHappyPathGenerateString(t *testing.T) {
-	random := rand.New(rand.NewSource(0))
+	state := newGeneratorState(0)
 	expected := "res1"
-	res, _ := newFieldGen("{string}[res1]{1}", random)()
+	res, _ := mustNewFieldGen("{string}[res1]{1}", state)()
 	if res != expected {
 		t.Errorf("expected %s, received %d", expected, res)
 	}
 
-	res, _ = newFieldGen("{string}[a-Z]{30}", random)()
-	if res != "yizABeAsCmGcYwewHIgmAhUHCEecEP" {
+	res, _ = mustNewFieldGen("{string}[a-Z]{30}", state)()
+	if res != "QiVSoKDgddbQelznittfoxbMXppgAx" {
 		t.Fail()
 	}
-	res, _ = newFieldGen("{string}[a-z]{10}[@]{1}[a-z]{10}[.org|.com]{1}", random)()
-	if res != "mpotqplyjo@fkueeaobht.org" {
+	res, _ = mustNewFieldGen("{string}[a-z]{10}[@]{1}[a-z]{10}[.org|.com]{1}", state)()
+	if res != "jpekivixks@palwclfodx.org" {
 		t.Fail()
 	}
-	res, _ = newFieldGen("{string}[a-z|A-Z|0-9|test]{30}", random)()
-	if res != "test2mptesttestttest8testtestx9test2test09LNf7test0test39g61" {
+	res, _ = mustNewFieldGen("{string}[a-z|A-Z|0-9|test]{30}", state)()
+	if res != "testtestYhsytestW1ZAtestjDNtesttestS58Rtest8testRU0m90" {
 		t.Fail()
 	}
-	res, _ = newFieldGen("{boolean}[false|true]{1}", random)()
-	if res != false {
+	res, _ = mustNewFieldGen("{boolean}[false|true]{1}", state)()
+	if res != true {
 		t.Fail()
 	}
 }
 
 func TestHappyPathGenerateFloat(t *testing.T) {
-	random := rand.New(rand.NewSource(0))
-	var expected float32 = 0.678
-	res, _ := newFieldGen("{float}[0]{1}[.]{1}[ 0-9 ]{3}", random)()
+	state := newGeneratorState(0)
+	var expected float32 = 0.632
+	res, _ := mustNewFieldGen("{float}[0]{1}[.]{1}[ 0-9 ]{3}", state)()
 	if res.(float32)-expected > 0.000001 {
 		t.Errorf("expected %f, received %f", expected, res)
 	}
 }
 
 func TestHappyPathGenerateUUID(t *testing.T) {
-	random := rand.New(rand.NewSource(0))
-	res, _ := newFieldGen("{string}[uuid()]{1}", random)()
+	state := newGeneratorState(0)
+	res, _ := mustNewFieldGen("{string}[uuid()]{1}", state)()
 	_, err := uuid.Parse(res.(string))
 	if err != nil {
 		t.Fail()
@@ -54,24 +54,24 @@ func TestHappyPathGenerateUUID(t *testing.T) {
 }
 
 func TestHappyPathGenerateInt(t *testing.T) {
-	random := rand.New(rand.NewSource(0))
+	state := newGeneratorState(0)
 	expected := 132
-	res, _ := newFieldGen("{int}[132]{1}", random)()
+	res, _ := mustNewFieldGen("{int}[132]{1}", state)()
 	if res != expected {
 		t.Errorf("expected %d, received %d", expected, res)
 	}
 	expected = 132231
-	res, _ = newFieldGen("{int}[132]{1}[231]{1}", random)()
+	res, _ = mustNewFieldGen("{int}[132]{1}[231]{1}", state)()
 	if res != expected {
 		t.Errorf("expected %d, received %d", expected, res)
 	}
 	expected = 911
-	res, _ = newFieldGen("{int}[1|9]{3}", random)()
+	res, _ = mustNewFieldGen("{int}[1|9]{3}", state)()
 	if res != expected {
 		t.Errorf("expected %d, received %d", expected, res)
 	}
-	var expectedL int64 = 303232103112013030
-	res, _ = newFieldGen("{long}[0|1|2|3]{18}", random)()
+	var expectedL int64 = 332010221333022130
+	res, _ = mustNewFieldGen("{long}[0|1|2|3]{18}", state)()
 	if res != expectedL {
 		t.Errorf("expected %d, received %d", expectedL, res)
 	}
@@ -81,8 +81,8 @@ func TestProbability(t *testing.T) {
 	// test that the probability of the `or` clauses is the same
 	// i.e. a-z|0-9 both the alphabetic values and the numeric values
 	// have the same prob to be picked
-	random := rand.New(rand.NewSource(0))
-	res, _ := newFieldGen("{string}[a-z|0-9|A-Z]{100000}", random)()
+	state := newGeneratorState(0)
+	res, _ := mustNewFieldGen("{string}[a-z|0-9|A-Z]{100000}", state)()
 	lower, digits, upper := 0, 0, 0
 	for _, l := range res.(string) {
 		if unicode.IsNumber(l) {
@@ -100,8 +100,134 @@ func TestProbability(t *testing.T) {
 }
 
 func TestNilIfInvalidPattern(t *testing.T) {
-	random := rand.New(rand.NewSource(0))
-	if newFieldGen("{string}[]{1}", random) != nil {
+	state := newGeneratorState(0)
+	if _, err := newFieldGen("{string}[]{1}", state); err == nil {
 		t.Fail()
 	}
 }
+
+func TestWeightedProbability(t *testing.T) {
+	state := newGeneratorState(0)
+	gen := mustNewFieldGen("{string}[ACTIVE|SUSPENDED|DELETED]{1}<90|9|1>", state)
+	counts := map[string]int{}
+	for i := 0; i < 100000; i++ {
+		res, _ := gen()
+		counts[res.(string)] += 1
+	}
+	if counts["ACTIVE"] < 89000 || counts["SUSPENDED"] < 8000 || counts["DELETED"] < 500 || counts["DELETED"] > 1500 {
+		fmt.Println(counts)
+		t.Fail()
+	}
+}
+
+func TestLettersProbability(t *testing.T) {
+	// a-Z should have the same probability of 0-9
+	state := newGeneratorState(0)
+	res, _ := mustNewFieldGen("{string}[a-Z|0-9]{100000}", state)()
+	letters, digits := 0, 0
+	for _, l := range res.(string) {
+		if unicode.IsNumber(l) {
+			digits += 1
+		} else {
+			letters += 1
+		}
+	}
+	if letters < 45000 || digits < 45000 {
+		fmt.Println(letters, digits)
+		t.Fail()
+	}
+}
+
+func TestHappyPathGenerateNumericRange(t *testing.T) {
+	state := newGeneratorState(0)
+	intGen := mustNewFieldGen("{int}[range(-10, 10)]{1}", state)
+	doubleGen := mustNewFieldGen("{double}[range(0.5, 1.5)]{1}", state)
+	for i := 0; i < 1000; i++ {
+		res, err := intGen()
+		if err != nil || res.(int) < -10 || res.(int) > 10 {
+			t.Errorf("unexpected value %v", res)
+		}
+		res, err = doubleGen()
+		if err != nil || res.(float64) < 0.5 || res.(float64) >= 1.5 {
+			t.Errorf("unexpected value %v", res)
+		}
+	}
+	res, _ := mustNewFieldGen("{string}[ID-]{1}[range(7, 7)]{1}", state)()
+	if res != "ID-7" {
+		t.Errorf("unexpected value %v", res)
+	}
+}
+
+func TestHappyPathGenerateNumericDistributions(t *testing.T) {
+	state := newGeneratorState(0)
+	normalGen := mustNewFieldGen("{double}[normal(100, 15)]{1}", state)
+	exponentialGen := mustNewFieldGen("{float}[exponential(0.5)]{1}", state)
+	zipfGen := mustNewFieldGen("{long}[zipf(1.5, 1, 1000)]{1}", state)
+	normalSum, exponentialSum := 0.0, 0.0
+	for i := 0; i < 10000; i++ {
+		res, _ := normalGen()
+		normalSum += res.(float64)
+		res, _ = exponentialGen()
+		exponentialSum += float64(res.(float32))
+		res, err := zipfGen()
+		if err != nil || res.(int64) < 0 || res.(int64) > 1000 {
+			t.Errorf("unexpected value %v", res)
+		}
+	}
+	if normalSum/10000 < 99 || normalSum/10000 > 101 {
+		t.Errorf("unexpected mean %f", normalSum/10000)
+	}
+	// the mean of the exponential distribution is 1/rate
+	if exponentialSum/10000 < 1.9 || exponentialSum/10000 > 2.1 {
+		t.Errorf("unexpected mean %f", exponentialSum/10000)
+	}
+}
+
+func TestHappyPathGenerateSequence(t *testing.T) {
+	state := newGeneratorState(0)
+	intGen := mustNewFieldGen("{int}[sequence(10, 5)]{1}", state)
+	stringGen := mustNewFieldGen("{string}[ID-]{1}[sequence(1, 1)]{1}", state)
+	for i := 0; i < 100; i++ {
+		// the sequence follows the index of the record
+		state.startRecord(int64(i))
+		res, _ := intGen()
+		if res != 10+i*5 {
+			t.Errorf("expected %d, received %d", 10+i*5, res)
+		}
+		res, _ = stringGen()
+		if res != fmt.Sprintf("ID-%d", i+1) {
+			t.Errorf("unexpected value %s", res)
+		}
+	}
+}
+
+func TestGenerateSequenceByKeyMaxKeys(t *testing.T) {
+	defer func(max int) { sequenceByKeyMaxKeys = max }(sequenceByKeyMaxKeys)
+	sequenceByKeyMaxKeys = 2
+	state := newGeneratorState(0)
+	gen := mustNewFieldGen("{long}[sequence_by_key(0, 1)]{1}", state)
+	for _, key := range []string{"a", "b", "a"} {
+		state.record.key = key
+		if _, err := gen(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	state.record.key = "c"
+	if _, err := gen(); err == nil || !strings.Contains(err.Error(), "can't keep more than 2 keys") {
+		t.Errorf("expected an error for too many keys, got %v", err)
+	}
+}
+
+func TestHappyPathGenerateSequenceByKey(t *testing.T) {
+	state := newGeneratorState(0)
+	gen := mustNewFieldGen("{long}[sequence_by_key(0, 1)]{1}", state)
+	for i := 0; i < 10; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			state.record.key = key
+			res, _ := gen()
+			if res != int64(i) {
+				t.Errorf("expected %d for the key %s, received %d", i, key, res)
+			}
+		}
+	}
+}
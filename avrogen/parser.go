@@ -0,0 +1,404 @@
+package avrogen
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/hamba/avro"
+)
+
+// AST of a generator pattern like `{string}[a-z|0-9]{10}[@]{1}`
+type patternAST struct {
+	type_  string
+	groups []groupAST
+}
+
+// list of options between brackets followed by the count
+type groupAST struct {
+	options []optionAST
+	// number of times the group is generated,
+	// a random number between count and maxCount (included)
+	count    int
+	maxCount int
+	// weight of each option, nil if the options
+	// have the same probability to be picked
+	weights []float64
+	// column of the opening bracket
+	col int
+}
+
+type optionAST struct {
+	// text of the option with the escape sequences already replaced
+	value string
+	// name and arguments if the option is a function call
+	isFunction bool
+	function   string
+	args       []string
+	// bounds if the option is a range like `a-f`
+	isRange  bool
+	from, to rune
+	// name if the option is a class like `:hex:`
+	class string
+	// column of the first character of the option
+	col int
+}
+
+// error found parsing a pattern, the column is 1-based
+type patternError struct {
+	col    int
+	reason string
+}
+
+func (e patternError) Error() string {
+	return fmt.Sprintf("%s at col %d", e.reason, e.col)
+}
+
+// parser of the generator patterns with the grammar:
+//
+//	pattern := '{' type '}' group+
+//	group   := '[' option ('|' option)* ']' '{' count (',' count)? '}' weights?
+//	option  := constant | range | class | function
+//	weights := '<' weight ('|' weight)* '>'
+type patternParser struct {
+	input []rune
+	pos   int
+}
+
+func parsePatternAST(raw string) (*patternAST, error) {
+	p := patternParser{input: []rune(raw)}
+	return p.parse()
+}
+
+func (p *patternParser) errorf(col int, format string, args ...interface{}) error {
+	return patternError{col: col, reason: fmt.Sprintf(format, args...)}
+}
+
+// 1-based column of the current position
+func (p *patternParser) col() int {
+	return p.pos + 1
+}
+
+func (p *patternParser) peek() (rune, bool) {
+	if p.pos >= len(p.input) {
+		return 0, false
+	}
+	return p.input[p.pos], true
+}
+
+func (p *patternParser) expect(r rune, what string) error {
+	c, ok := p.peek()
+	if !ok {
+		return p.errorf(p.col(), "expected '%c' %s, found the end of the pattern", r, what)
+	}
+	if c != r {
+		return p.errorf(p.col(), "expected '%c' %s, found '%c'", r, what, c)
+	}
+	p.pos++
+	return nil
+}
+
+// read the text until the closing curly bracket
+func (p *patternParser) readUntilCurlyBracket(openCol int) (string, error) {
+	start := p.pos
+	for p.pos < len(p.input) && p.input[p.pos] != '}' {
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return "", p.errorf(openCol, "missing '}' for the '{'")
+	}
+	res := string(p.input[start:p.pos])
+	p.pos++
+	return res, nil
+}
+
+func (p *patternParser) parse() (*patternAST, error) {
+	if err := p.expect('{', "at the beginning of the pattern"); err != nil {
+		return nil, err
+	}
+	typeCol := p.col()
+	for c, ok := p.peek(); ok && c >= 'a' && c <= 'z'; c, ok = p.peek() {
+		p.pos++
+	}
+	patternType := string(p.input[typeCol-1 : p.pos])
+	if err := p.expect('}', "after the type"); err != nil {
+		return nil, err
+	}
+	switch avro.Type(patternType) {
+	case avro.Null, avro.Boolean, avro.Int, avro.Long, avro.Float, avro.Double, avro.Bytes, avro.String:
+	default:
+		return nil, p.errorf(typeCol, "unknown type '%s'", patternType)
+	}
+	res := &patternAST{type_: patternType}
+	for {
+		if _, ok := p.peek(); !ok && len(res.groups) > 0 {
+			return res, nil
+		}
+		group, err := p.parseGroup()
+		if err != nil {
+			return nil, err
+		}
+		res.groups = append(res.groups, *group)
+	}
+}
+
+func (p *patternParser) parseGroup() (*groupAST, error) {
+	group := &groupAST{col: p.col()}
+	if err := p.expect('[', "to start the list of options"); err != nil {
+		return nil, err
+	}
+	for {
+		option, err := p.parseOption(group.col)
+		if err != nil {
+			return nil, err
+		}
+		group.options = append(group.options, *option)
+		// the option is terminated either by '|' or ']'
+		c, _ := p.peek()
+		p.pos++
+		if c == ']' {
+			break
+		}
+	}
+	countCol := p.col()
+	if err := p.expect('{', "with the count after the options"); err != nil {
+		return nil, err
+	}
+	rawCount, err := p.readUntilCurlyBracket(countCol)
+	if err != nil {
+		return nil, err
+	}
+	// either a fixed count like `{5}` or a range like `{3,12}`
+	bounds := strings.SplitN(rawCount, ",", 2)
+	group.count, err = parseCount(bounds[0])
+	if err != nil {
+		return nil, p.errorf(countCol+1, "invalid count '%s'", rawCount)
+	}
+	group.maxCount = group.count
+	if len(bounds) == 2 {
+		group.maxCount, err = parseCount(strings.TrimLeft(bounds[1], " "))
+		if err != nil {
+			return nil, p.errorf(countCol+1, "invalid count '%s'", rawCount)
+		}
+		if group.maxCount < group.count {
+			return nil, p.errorf(countCol+1, "invalid count '%s', the minimum needs to be less than or equal to the maximum", rawCount)
+		}
+	}
+	if c, ok := p.peek(); ok && c == '<' {
+		if group.weights, err = p.parseWeights(len(group.options)); err != nil {
+			return nil, err
+		}
+	}
+	return group, nil
+}
+
+// parse the weights of the options like `<90|9|1>`
+func (p *patternParser) parseWeights(options int) ([]float64, error) {
+	openCol := p.col()
+	start := p.pos + 1
+	for p.pos < len(p.input) && p.input[p.pos] != '>' {
+		p.pos++
+	}
+	if p.pos >= len(p.input) {
+		return nil, p.errorf(openCol, "missing '>' for the '<'")
+	}
+	raw := strings.Split(string(p.input[start:p.pos]), "|")
+	p.pos++
+	if len(raw) != options {
+		return nil, p.errorf(openCol, "expected %d weights, one for each option, found %d", options, len(raw))
+	}
+	var res []float64
+	for _, w := range raw {
+		weight, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+		if err != nil || weight <= 0 {
+			return nil, p.errorf(openCol, "the weight '%s' needs to be a positive number", strings.TrimSpace(w))
+		}
+		res = append(res, weight)
+	}
+	return res, nil
+}
+
+func parseCount(raw string) (int, error) {
+	res, err := strconv.Atoi(raw)
+	if err != nil || res < 0 || strings.TrimSpace(raw) != raw {
+		return 0, fmt.Errorf("invalid count %s", raw)
+	}
+	return res, nil
+}
+
+// parse an option until the next '|' or ']'.
+// The separators are allowed within parenthesis and quotes,
+// e.g. in the arguments of the functions
+func (p *patternParser) parseOption(groupCol int) (*optionAST, error) {
+	start := p.pos
+	depth := 0
+	quoted := false
+	for {
+		c, ok := p.peek()
+		if !ok {
+			if quoted {
+				return nil, p.errorf(groupCol, "missing '\"' in the options")
+			}
+			if depth > 0 {
+				return nil, p.errorf(groupCol, "missing ')' in the options")
+			}
+			return nil, p.errorf(groupCol, "missing ']' for the '['")
+		}
+		switch {
+		case c == '\\':
+			// skip the escaped character
+			p.pos++
+			if p.pos >= len(p.input) {
+				return nil, p.errorf(p.col()-1, "incomplete escape sequence")
+			}
+		case c == '"' && depth > 0:
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return nil, p.errorf(p.col(), "unexpected ')'")
+			}
+		case depth == 0 && (c == '|' || c == ']'):
+			return p.newOption(start, p.pos)
+		}
+		p.pos++
+	}
+}
+
+func (p *patternParser) newOption(start int, end int) (*optionAST, error) {
+	if strings.TrimSpace(string(p.input[start:end])) == "" {
+		return nil, p.errorf(start+1, "empty option")
+	}
+	// trim the spaces keeping track of the column
+	for start < end && unicode.IsSpace(p.input[start]) {
+		start++
+	}
+	// keep the escaped spaces
+	for end > start && unicode.IsSpace(p.input[end-1]) && !(end-2 >= start && p.input[end-2] == '\\') {
+		end--
+	}
+	col := start + 1
+	option := &optionAST{col: col}
+	raw := string(p.input[start:end])
+	runes := []rune(raw)
+	// only the known functions are parsed, any other `name(args)` is a constant
+	if open := strings.Index(raw, "("); open > 0 && strings.HasSuffix(raw, ")") {
+		name := raw[:open]
+		if patternFunctions[name] {
+			args, err := splitArgs(raw[open+1 : len(raw)-1])
+			if err != nil {
+				return nil, p.errorf(col, "invalid arguments of the function '%s()', %s", name, err.Error())
+			}
+			option.isFunction, option.function, option.args, option.value = true, name, args, raw
+			return option, nil
+		}
+	}
+	// range like `a-f`, the special range `a-Z` includes all the letters
+	if len(runes) == 3 && runes[1] == '-' && runes[0] != '\\' && runes[2] != '\\' {
+		if runes[0] > runes[2] && raw != "a-Z" {
+			return nil, p.errorf(col, "invalid range '%s', the first character needs to precede the second one", raw)
+		}
+		option.isRange, option.from, option.to, option.value = true, runes[0], runes[2], raw
+		return option, nil
+	}
+	// class like `:hex:`
+	if len(runes) > 2 && runes[0] == ':' && runes[len(runes)-1] == ':' && strings.Trim(raw, ":") != "" &&
+		strings.IndexFunc(strings.Trim(raw, ":"), func(r rune) bool { return !unicode.IsLetter(r) }) < 0 {
+		option.class, option.value = raw, raw
+		return option, nil
+	}
+	value, err := unescape(raw)
+	if err != nil {
+		return nil, p.errorf(col, "%s", err.Error())
+	}
+	option.value = value
+	return option, nil
+}
+
+// replace the escape sequences: `\n`, `\t`, `\uXXXX` and any
+// punctuation or space preceded by a backslash, e.g. `\|`
+func unescape(raw string) (string, error) {
+	var res strings.Builder
+	runes := []rune(raw)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '\\' {
+			res.WriteRune(runes[i])
+			continue
+		}
+		i++
+		if i >= len(runes) {
+			return "", fmt.Errorf("incomplete escape sequence")
+		}
+		switch c := runes[i]; {
+		case c == 'n':
+			res.WriteRune('\n')
+		case c == 't':
+			res.WriteRune('\t')
+		case c == 'u':
+			if i+4 >= len(runes) {
+				return "", fmt.Errorf("invalid escape sequence '\\u%s'", string(runes[i+1:]))
+			}
+			code, err := strconv.ParseUint(string(runes[i+1:i+5]), 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("invalid escape sequence '\\u%s'", string(runes[i+1:i+5]))
+			}
+			res.WriteRune(rune(code))
+			i += 4
+		case unicode.IsPunct(c) || unicode.IsSymbol(c) || unicode.IsSpace(c):
+			res.WriteRune(c)
+		default:
+			return "", fmt.Errorf("unknown escape sequence '\\%c'", c)
+		}
+	}
+	return res.String(), nil
+}
+
+// split the arguments of a function by comma.
+// Quoted arguments can contain commas and escaped quotes
+func splitArgs(raw string) ([]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var res []string
+	var current strings.Builder
+	quoted := false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(raw):
+			current.WriteByte(c)
+			current.WriteByte(raw[i+1])
+			i++
+			continue
+		case c == '"':
+			quoted = !quoted
+		case c == ',' && !quoted:
+			res = append(res, current.String())
+			current.Reset()
+			continue
+		}
+		current.WriteByte(c)
+	}
+	res = append(res, current.String())
+	for i, a := range res {
+		a = strings.TrimSpace(a)
+		if strings.HasPrefix(a, "\"") {
+			if len(a) < 2 || !strings.HasSuffix(a, "\"") {
+				return nil, fmt.Errorf("invalid quoted argument %s", a)
+			}
+			unquoted, err := strconv.Unquote(a)
+			if err != nil {
+				// keep the unknown escape sequences as they are,
+				// e.g. `\d` in the regular expressions
+				unquoted = strings.ReplaceAll(a[1:len(a)-1], `\"`, `"`)
+			}
+			a = unquoted
+		}
+		res[i] = a
+	}
+	return res, nil
+}
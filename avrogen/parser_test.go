@@ -0,0 +1,168 @@
+package avrogen
+
+import (
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestParsePatternErrors(t *testing.T) {
+	state := newGeneratorState(0)
+	for pattern, expected := range map[string]string{
+		"string}[a]{1}":                  "expected '{' at the beginning of the pattern, found 's' at col 1",
+		"{strin}[a]{1}":                  "unknown type 'strin' at col 2",
+		"{string[a]{1}":                  "expected '}' after the type, found '[' at col 8",
+		"{string}":                       "expected '[' to start the list of options, found the end of the pattern at col 9",
+		"{string}[a]{1}b":                "expected '[' to start the list of options, found 'b' at col 15",
+		"{string}[a":                     "missing ']' for the '[' at col 9",
+		"{string}[a]":                    "expected '{' with the count after the options, found the end of the pattern at col 12",
+		"{string}[a]{1a}":                "invalid count '1a' at col 13",
+		"{string}[a]{1":                  "missing '}' for the '{' at col 12",
+		"{string}[]{1}":                  "empty option at col 10",
+		"{string}[a| ]{1}":               "empty option at col 12",
+		"{string}[test-] [uid()]{1}":     "expected '{' with the count after the options, found ' ' at col 16",
+		"{string}[test-]{1}[uuid(1)]{1}": "invalid arguments (1) of the function 'uuid()' at col 20",
+		"{int}[range(1)]{1}":             "invalid arguments (1) of the function 'range()' at col 7",
+		"{string}[uuid(1)]{1}":           "invalid arguments (1) of the function 'uuid()' at col 10",
+		"{string}[a|b]{1}<1>":            "expected 2 weights, one for each option, found 1 at col 17",
+		"{string}[a|b]{1}<0|1>":          "the weight '0' needs to be a positive number at col 17",
+		"{string}[a|b]{1}<x|1>":          "the weight 'x' needs to be a positive number at col 17",
+		"{string}[a|b]{1}<1|2":           "missing '>' for the '<' at col 17",
+		"{string}[range(1,2]{1}":         "missing ')' in the options at col 9",
+		"{string}[a)]{1}":                "unexpected ')' at col 11",
+		"{string}[hex(\"ab)]{1}":         "missing '\"' in the options at col 9",
+		"{string}[ok]{1}[iban(\"IT]{1}":  "missing '\"' in the options at col 16",
+		"{string}[z-a]{1}":               "invalid range 'z-a', the first character needs to precede the second one at col 10",
+		"{string}[:hexa:]{1}":            "unknown class ':hexa:' at col 10",
+		"{string}[a\\q]{1}":              "unknown escape sequence '\\q' at col 10",
+		"{string}[a\\u12]{1}":            "invalid escape sequence '\\u12' at col 10",
+		"{string}[a\\":                   "incomplete escape sequence at col 11",
+		"{string}[a]{3,}":                "invalid count '3,' at col 13",
+		"{string}[a]{,3}":                "invalid count ',3' at col 13",
+		"{string}[a]{12,3}":              "invalid count '12,3', the minimum needs to be less than or equal to the maximum at col 13",
+	} {
+		_, err := parsePattern(pattern, state)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected the error `%s` for the pattern %s, got `%v`", expected, pattern, err)
+		}
+	}
+}
+
+func TestParsePatternAST(t *testing.T) {
+	ast, err := parsePatternAST(`{string}[ ID- ]{1}[a-z | iban("IT")]{3}<2|1>[range(1, 2)|x|y]{0}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ast.type_ != "string" || len(ast.groups) != 3 {
+		t.Fatalf("unexpected ast %v", ast)
+	}
+	if o := ast.groups[0].options[0]; o.value != "ID-" || o.col != 11 || o.isFunction {
+		t.Errorf("unexpected constant option %v", o)
+	}
+	g := ast.groups[1]
+	if g.count != 3 || len(g.options) != 2 || len(g.weights) != 2 || g.weights[0] != 2 || g.weights[1] != 1 {
+		t.Errorf("unexpected group %v", g)
+	}
+	if o := g.options[1]; !o.isFunction || o.function != "iban" || len(o.args) != 1 || o.args[0] != "IT" {
+		t.Errorf("unexpected function option %v", o)
+	}
+	if o := ast.groups[2].options[0]; o.function != "range" || len(o.args) != 2 || o.args[1] != "2" || ast.groups[2].count != 0 {
+		t.Errorf("unexpected function option %v", o)
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	args, err := splitArgs(` a , "b,c" , "d\"e" ,`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 4 || args[0] != "a" || args[1] != "b,c" || args[2] != `d"e` || args[3] != "" {
+		t.Errorf("unexpected arguments %q", args)
+	}
+}
+
+func TestParseEscapes(t *testing.T) {
+	state := newGeneratorState(0)
+	for pattern, expected := range map[string]string{
+		`{string}[a\|b]{1}`:       "a|b",
+		`{string}[\[x\]]{1}`:      "[x]",
+		`{string}[\{1\}]{1}`:      "{1}",
+		`{string}[a\-z]{1}`:       "a-z",
+		`{string}[\\]{1}`:         `\`,
+		`{string}[ a\ ]{1}`:       "a ",
+		`{string}[x\:3]{1}`:       "x:3",
+		`{string}[\u03b1\t\n]{1}`: "α\t\n",
+		`{string}[a\|b]{1}<1>`:    "a|b",
+		`{string}[12:30]{1}`:      "12:30",
+	} {
+		value, err := mustNewFieldGen(pattern, state)()
+		if err != nil || value != expected {
+			t.Errorf("expected %q for the pattern %s, got %q", expected, pattern, value)
+		}
+	}
+}
+
+func TestParseRangesAndClasses(t *testing.T) {
+	state := newGeneratorState(0)
+	for pattern, valid := range map[string]func(r rune) bool{
+		"{string}[a-f]{50}":   func(r rune) bool { return r >= 'a' && r <= 'f' },
+		"{string}[0-5]{50}":   func(r rune) bool { return r >= '0' && r <= '5' },
+		"{string}[α-ω]{50}":   func(r rune) bool { return r >= 'α' && r <= 'ω' },
+		"{string}[:hex:]{50}": func(r rune) bool { return strings.ContainsRune("0123456789abcdef", r) },
+		"{string}[:HEX:]{50}": func(r rune) bool { return strings.ContainsRune("0123456789ABCDEF", r) },
+		// some of the ascii punctuation is categorized as symbols in unicode
+		"{string}[:punct:]{50}":   func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSymbol(r) },
+		"{string}[:space:]{50}":   unicode.IsSpace,
+		"{string}[:unicode:]{50}": func(r rune) bool { return unicode.IsLetter(r) && r > unicode.MaxASCII },
+		"{string}[:emoji:]{50}":   func(r rune) bool { return r >= 0x1F300 && r <= 0x1F6FF },
+	} {
+		value, err := mustNewFieldGen(pattern, state)()
+		if err != nil {
+			t.Fatal(err)
+		}
+		runes := []rune(value.(string))
+		if len(runes) != 50 {
+			t.Errorf("expected 50 characters for the pattern %s, got %q", pattern, value)
+		}
+		for _, r := range runes {
+			if !valid(r) {
+				t.Errorf("unexpected character %q for the pattern %s", r, pattern)
+			}
+		}
+	}
+}
+
+func TestParseCountRanges(t *testing.T) {
+	state := newGeneratorState(0)
+	ast, err := parsePatternAST("{string}[a]{3, 12}[b]{0,1}[c]{2}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g := ast.groups[0]; g.count != 3 || g.maxCount != 12 {
+		t.Errorf("unexpected count range %d,%d", g.count, g.maxCount)
+	}
+	if g := ast.groups[2]; g.count != 2 || g.maxCount != 2 {
+		t.Errorf("unexpected fixed count %d,%d", g.count, g.maxCount)
+	}
+	gen := mustNewFieldGen("{string}[a]{3,12}[b]{0,1}", state)
+	lengths := map[int]bool{}
+	suffixes := map[bool]bool{}
+	for i := 0; i < 1000; i++ {
+		value, _ := gen()
+		v := value.(string)
+		suffixes[strings.HasSuffix(v, "b")] = true
+		v = strings.TrimSuffix(v, "b")
+		if len(v) < 3 || len(v) > 12 || strings.Trim(v, "a") != "" {
+			t.Fatalf("unexpected value %s", value)
+		}
+		lengths[len(v)] = true
+	}
+	if len(lengths) != 10 || len(suffixes) != 2 {
+		t.Errorf("expected all the lengths and the optional suffix, got %v %v", lengths, suffixes)
+	}
+	// variable number of digits
+	value, err := mustNewFieldGen("{int}[1-9]{1}[0-9]{0,3}", state)()
+	if err != nil || value.(int) < 1 || value.(int) > 9999 {
+		t.Errorf("unexpected number %v", value)
+	}
+}
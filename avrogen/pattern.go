@@ -1,11 +1,13 @@
 package avrogen
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
-	"regexp"
+	"math"
+	"math/rand"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/google/uuid"
 	"github.com/hamba/avro"
@@ -13,7 +15,13 @@ import (
 
 type patternOption struct {
 	options []func() []string
-	count   int
+	// weight of each option, nil if the options
+	// have the same probability to be picked
+	weights []float64
+	// the options are generated a random number
+	// of times between count and maxCount
+	count    int
+	maxCount int
 }
 
 type pattern struct {
@@ -31,76 +39,344 @@ func getLowerCaseLetters() []string {
 		"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "o", "p", "q", "r", "s", "t", "u", "v", "w", "x", "y", "z",
 	}
 }
+func getLetters() []string {
+	return append(getUpperCaseLetters(), getLowerCaseLetters()...)
+}
 func getDigits() []string {
 	return []string{
 		"0", "1", "2", "3", "4", "5", "6", "7", "8", "9",
 	}
 }
 
-func parsePattern(p string) *pattern {
-	patternType, rawContent, ok := parsePatternType(p)
-	if !ok {
-		return nil
+// return the characters between from and to, both included
+func runeRange(from rune, to rune) []string {
+	var res []string
+	for r := from; r <= to; r++ {
+		res = append(res, string(r))
 	}
+	return res
+}
 
-	var re = regexp.MustCompile(`\[([^\]]+)\]\{(\d+)\}`)
-	var matches = re.FindAllStringSubmatch(rawContent, -1)
+// characters of the classes available in the patterns, e.g. `:hex:`
+var characterClasses = map[string][]string{
+	":hex:":   append(getDigits(), runeRange('a', 'f')...),
+	":HEX:":   append(getDigits(), runeRange('A', 'F')...),
+	":punct:": strings.Split("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", ""),
+	":space:": {" ", "\t", "\n", "\r"},
+	// letters of the latin-1 supplement, greek, cyrillic, hebrew, arabic and CJK blocks
+	":unicode:": append(append(append(append(append(append(runeRange('À', 'Ö'), runeRange('Ø', 'ö')...),
+		runeRange('α', 'ω')...), runeRange('а', 'я')...), runeRange('א', 'ת')...), runeRange('ا', 'ي')...),
+		runeRange('一', '龥')...),
+	// emoticons, pictographs, transport and map symbols
+	":emoji:": append(append(runeRange('\U0001F600', '\U0001F64F'), runeRange('\U0001F300', '\U0001F5FF')...),
+		runeRange('\U0001F680', '\U0001F6C5')...),
+}
+
+// functions available in the patterns
+var patternFunctions = map[string]bool{
+	"uuid": true, "timestamp_ms": true,
+	"hex": true, "base64": true, "random_bytes": true,
+	"range": true, "normal": true, "exponential": true, "zipf": true,
+	"sequence": true, "sequence_by_key": true, "regex": true,
+	"first_name": true, "last_name": true, "full_name": true, "email": true, "street_address": true, "city": true,
+	"postcode": true, "country": true, "phone_number": true, "company": true, "iban": true, "credit_card": true,
+}
+
+// compile the pattern into the options used by the generator
+func parsePattern(p string, state *generatorState) (*pattern, error) {
+	ast, err := parsePatternAST(p)
+	if err != nil {
+		return nil, err
+	}
 	content := []patternOption{}
-	for _, c := range matches {
-		count, _ := strconv.Atoi(c[2])
+	for _, g := range ast.groups {
 		var options []func() []string
-		for _, c := range strings.Split(c[1], "|") {
-			switch strings.Trim(c, " ") {
-			case "a-z":
-				options = append(options, getLowerCaseLetters)
-			case "A-Z":
-				options = append(options, getUpperCaseLetters)
-			case "0-9":
-				options = append(options, getDigits)
-			case "a-Z":
-				options = append(options, getUpperCaseLetters, getLowerCaseLetters)
-			case "uuid()":
-				options = append(options, func() []string { return []string{uuid.New().String()} })
-			case "timestamp_ms()":
-				options = append(options, func() []string {
-					return []string{
-						fmt.Sprintf("%d", time.Now().UnixMilli())}
-				})
-			default:
-				// constant case
-				// important: need to reassign the c into s
-				// otherwise the closure `func` will alway point
-				// to the latest c value
-				s := strings.Trim(c, " ")
-				options = append(options, func() []string { return []string{s} })
+		for _, o := range g.options {
+			// the sequences generate one value per call
+			if o.isFunction && (o.function == "sequence" || o.function == "sequence_by_key") && (g.count != 1 || g.maxCount != 1) {
+				return nil, patternError{col: o.col, reason: fmt.Sprintf("the function '%s()' can only be used in a group with count 1", o.function)}
+			}
+			option, err := compileOption(o, ast.type_, state)
+			if err != nil {
+				return nil, err
 			}
+			options = append(options, option)
 		}
-
-		content = append(content, patternOption{options: options, count: count})
+		content = append(content, patternOption{options: options, weights: g.weights, count: g.count, maxCount: g.maxCount})
 	}
-
 	return &pattern{
-		type_:   patternType,
+		type_:   ast.type_,
 		content: content,
+	}, nil
+}
+
+func compileOption(o optionAST, patternType string, state *generatorState) (func() []string, error) {
+	if o.isFunction {
+		if o.function == "regex" {
+			return parseRegexFunction(o, state)
+		}
+		option := parseFunctionOption(o.function, o.args, patternType, state)
+		if option == nil {
+			return nil, patternError{col: o.col, reason: fmt.Sprintf("invalid arguments (%s) of the function '%s()'", strings.Join(o.args, ","), o.function)}
+		}
+		return option, nil
+	}
+	if o.isRange {
+		if o.value == "a-Z" {
+			letters := getLetters()
+			return func() []string { return letters }, nil
+		}
+		values := runeRange(o.from, o.to)
+		return func() []string { return values }, nil
+	}
+	if o.class != "" {
+		values, ok := characterClasses[o.class]
+		if !ok {
+			return nil, patternError{col: o.col, reason: fmt.Sprintf("unknown class '%s'", o.class)}
+		}
+		return func() []string { return values }, nil
+	}
+	// constant case
+	values := []string{o.value}
+	return func() []string { return values }, nil
+}
+
+// number of times the options are generated
+func (p patternOption) pickCount(random *rand.Rand) int {
+	if p.maxCount <= p.count {
+		return p.count
+	}
+	return p.count + random.Intn(p.maxCount-p.count+1)
+}
+
+// return true if the pattern uses the function
+func usesFunction(rawPattern string, function string) bool {
+	ast, err := parsePatternAST(rawPattern)
+	if err != nil {
+		return false
+	}
+	for _, g := range ast.groups {
+		for _, o := range g.options {
+			if o.isFunction && o.function == function {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pick the index of an option accordingly to the weights
+func (p patternOption) pickOption(random *rand.Rand) int {
+	if p.weights == nil {
+		return random.Intn(len(p.options))
+	}
+	total := 0.0
+	for _, w := range p.weights {
+		total += w
+	}
+	r := random.Float64() * total
+	for i, w := range p.weights {
+		if r < w {
+			return i
+		}
+		r -= w
+	}
+	return len(p.weights) - 1
+}
+
+// parse the functions with arguments
+// returns nil if the function or its arguments are invalid
+func parseFunctionOption(function string, args []string, patternType string, state *generatorState) func() []string {
+	switch function {
+	case "uuid":
+		if len(args) > 0 {
+			return nil
+		}
+		return func() []string {
+			// random uuid (v4) derived from the seeded source
+			id, err := uuid.NewRandomFromReader(state.random)
+			if err != nil {
+				panic(err)
+			}
+			return []string{id.String()}
+		}
+	case "timestamp_ms":
+		if len(args) > 0 {
+			return nil
+		}
+		return func() []string { return []string{fmt.Sprintf("%d", state.now().UnixMilli())} }
+	case "hex", "base64", "random_bytes":
+		return parseBytesFunction(function, args, state.random)
+	case "range", "normal", "exponential", "zipf":
+		return parseNumericFunction(function, args, patternType, state.random)
+	case "sequence", "sequence_by_key":
+		return parseSequenceFunction(function, args, state)
+	default:
+		return parseFakeFunction(function, args, state)
+	}
+}
+
+// parse the function `regex(pattern)`, the syntax
+// errors of the pattern are reported as they are
+func parseRegexFunction(o optionAST, state *generatorState) (func() []string, error) {
+	if len(o.args) != 1 {
+		return nil, patternError{col: o.col, reason: fmt.Sprintf("invalid arguments (%s) of the function 'regex()'", strings.Join(o.args, ","))}
+	}
+	gen, err := newRegexGen(o.args[0], state.random)
+	if err != nil {
+		return nil, patternError{col: o.col, reason: fmt.Sprintf("invalid regex of the function 'regex()', %s", err.Error())}
+	}
+	return func() []string { return []string{gen.generate()} }, nil
+}
+
+// parse the functions that generate raw bytes
+// returns nil if the function or its arguments are invalid
+func parseBytesFunction(function string, args []string, random *rand.Rand) func() []string {
+	switch function {
+	case "hex":
+		if len(args) != 1 {
+			return nil
+		}
+		decoded, err := hex.DecodeString(args[0])
+		if err != nil {
+			return nil
+		}
+		return func() []string { return []string{string(decoded)} }
+	case "base64":
+		if len(args) != 1 {
+			return nil
+		}
+		decoded, err := base64.StdEncoding.DecodeString(args[0])
+		if err != nil {
+			return nil
+		}
+		return func() []string { return []string{string(decoded)} }
+	case "random_bytes":
+		if len(args) != 2 {
+			return nil
+		}
+		min, errMin := strconv.Atoi(args[0])
+		max, errMax := strconv.Atoi(args[1])
+		if errMin != nil || errMax != nil || min < 0 || max < min {
+			return nil
+		}
+		return func() []string {
+			res := make([]byte, min+random.Intn(max-min+1))
+			random.Read(res)
+			return []string{string(res)}
+		}
+	}
+	return nil
+}
+
+// parse the functions that generate numbers.
+// Floats are only generated for float and double patterns,
+// for any other type the result is rounded to an integer
+func parseNumericFunction(function string, args []string, patternType string, random *rand.Rand) func() []string {
+	isFloat := patternType == string(avro.Float) || patternType == string(avro.Double)
+	values, err := parseFloatArgs(args)
+	if err != nil {
+		return nil
+	}
+	var gen func() float64
+	switch function {
+	case "range":
+		if len(values) != 2 || values[0] > values[1] {
+			return nil
+		}
+		min, max := values[0], values[1]
+		if !isFloat {
+			// the bounds are included in the integer range
+			minInt, maxInt := int64(math.Ceil(min)), int64(math.Floor(max))
+			if maxInt < minInt || maxInt-minInt+1 <= 0 {
+				return nil
+			}
+			// the values need to fit the int type
+			if patternType == string(avro.Int) && (minInt < math.MinInt32 || maxInt > math.MaxInt32) {
+				return nil
+			}
+			return func() []string {
+				return []string{strconv.FormatInt(minInt+random.Int63n(maxInt-minInt+1), 10)}
+			}
+		}
+		gen = func() float64 { return min + random.Float64()*(max-min) }
+	case "normal":
+		if len(values) != 2 || values[1] < 0 {
+			return nil
+		}
+		mean, stddev := values[0], values[1]
+		gen = func() float64 { return mean + random.NormFloat64()*stddev }
+	case "exponential":
+		if len(values) != 1 || values[0] <= 0 {
+			return nil
+		}
+		rate := values[0]
+		gen = func() float64 { return random.ExpFloat64() / rate }
+	case "zipf":
+		if len(values) != 3 || values[0] <= 1 || values[1] < 1 || values[2] < 0 {
+			return nil
+		}
+		if patternType == string(avro.Int) && values[2] > math.MaxInt32 {
+			return nil
+		}
+		zipf := rand.NewZipf(random, values[0], values[1], uint64(values[2]))
+		gen = func() float64 { return float64(zipf.Uint64()) }
+	default:
+		return nil
+	}
+	if isFloat {
+		return func() []string { return []string{strconv.FormatFloat(gen(), 'f', -1, 64)} }
 	}
+	return func() []string { return []string{strconv.FormatInt(int64(math.Round(gen())), 10)} }
 }
 
-// parse the pattern and returns the type and the content
-func parsePatternType(p string) (string, string, bool) {
-	types := strings.Join([]string{
-		string(avro.Null),
-		string(avro.Boolean),
-		string(avro.Int),
-		string(avro.Long),
-		string(avro.Float),
-		string(avro.Double),
-		string(avro.String)}, "|")
-	regex := fmt.Sprintf(`^\{(%s)\}((\[([^\]]+)\]\{(\d+)\})+)$`, types)
-	var re = regexp.MustCompile(regex)
-	var matches = re.FindAllStringSubmatch(p, -1)
-	if matches == nil || len(matches) != 1 {
-		// invalid pattern
-		return "", "", false
-	}
-	return matches[0][1], matches[0][2], true
+func parseFloatArgs(args []string) ([]float64, error) {
+	var res []float64
+	for _, a := range args {
+		value, err := strconv.ParseFloat(a, 64)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, value)
+	}
+	return res, nil
+}
+
+// max number of keys kept in memory by sequence_by_key()
+var sequenceByKeyMaxKeys = 1000000
+
+// parse the functions that generate a sequence of integers.
+// The sequence follows the index of the record, while
+// the state of the sequences by key is kept in the closure
+func parseSequenceFunction(function string, args []string, state *generatorState) func() []string {
+	if len(args) != 2 {
+		return nil
+	}
+	start, errStart := strconv.ParseInt(args[0], 10, 64)
+	step, errStep := strconv.ParseInt(args[1], 10, 64)
+	if errStart != nil || errStep != nil {
+		return nil
+	}
+	switch function {
+	case "sequence":
+		return func() []string {
+			return []string{strconv.FormatInt(start+step*state.record.index, 10)}
+		}
+	case "sequence_by_key":
+		// one sequence for each record key
+		next := map[string]int64{}
+		return func() []string {
+			res, ok := next[state.record.key]
+			if !ok {
+				if len(next) >= sequenceByKeyMaxKeys {
+					state.record.err = fmt.Errorf("sequence_by_key() can't keep more than %d keys, the key rule generates too many distinct keys", sequenceByKeyMaxKeys)
+					return []string{""}
+				}
+				res = start
+			}
+			next[state.record.key] = res + step
+			return []string{strconv.FormatInt(res, 10)}
+		}
+	}
+	return nil
 }
@@ -5,31 +5,42 @@ import (
 	"time"
 )
 
+func mustParsePattern(t *testing.T, p string, state *generatorState) *pattern {
+	res, err := parsePattern(p, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
 func TestParseInvalidPattern(t *testing.T) {
+	state := newGeneratorState(0)
 	// parse pattern with invalid type
-	if parsePattern("{asdf}[a]{1}") != nil {
+	if _, err := parsePattern("{asdf}[a]{1}", state); err == nil {
 		t.Fail()
 	}
 	// parse pattern with invalid content
-	if parsePattern("{asdf}[]{1}") != nil {
+	if _, err := parsePattern("{asdf}[]{1}", state); err == nil {
 		t.Fail()
 	}
 	// parse pattern with invalid count
-	if parsePattern("{asdf}[a]{1a}") != nil {
+	if _, err := parsePattern("{asdf}[a]{1a}", state); err == nil {
 		t.Fail()
 	}
 }
 
 func TestTrimOrClauses(t *testing.T) {
+	state := newGeneratorState(0)
 	// the first option should be all the letters
-	option1 := parsePattern("{string}[ a-Z | 0 ]{1}").content[0].options[0]
+	option1 := mustParsePattern(t, "{string}[ a-Z | 0 ]{1}", state).content[0].options[0]
 	if len(option1()) == 1 || option1()[0][0] == ' ' {
 		t.Fail()
 	}
 }
 
 func TestParseUUIDFunction(t *testing.T) {
-	uuidGen := parsePattern("{string}[ uuid() ]{1}").content[0].options[0]
+	state := newGeneratorState(0)
+	uuidGen := mustParsePattern(t, "{string}[ uuid() ]{1}", state).content[0].options[0]
 	uuid1 := uuidGen()
 	uuid2 := uuidGen()
 	if len(uuid1) != 1 || len(uuid2) != 1 {
@@ -43,7 +54,8 @@ func TestParseUUIDFunction(t *testing.T) {
 }
 
 func TestParseTimestampFunction(t *testing.T) {
-	timestampGen := parsePattern("{string}[ timestamp_ms() ]{1}").content[0].options[0]
+	state := newGeneratorState(0)
+	timestampGen := mustParsePattern(t, "{string}[ timestamp_ms() ]{1}", state).content[0].options[0]
 	time1 := timestampGen()
 	time.Sleep(1 * time.Millisecond)
 	time2 := timestampGen()
@@ -56,3 +68,102 @@ func TestParseTimestampFunction(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestParseBytesFunctions(t *testing.T) {
+	state := newGeneratorState(0)
+	hexGen := mustParsePattern(t, "{bytes}[ hex(0aff) ]{1}", state).content[0].options[0]
+	if hexGen()[0] != "\x0a\xff" {
+		t.Fail()
+	}
+	base64Gen := mustParsePattern(t, "{bytes}[ base64(AQID) ]{1}", state).content[0].options[0]
+	if base64Gen()[0] != "\x01\x02\x03" {
+		t.Fail()
+	}
+	randomGen := mustParsePattern(t, "{bytes}[ random_bytes(3, 3) ]{1}", state).content[0].options[0]
+	if len(randomGen()[0]) != 3 {
+		t.Fail()
+	}
+}
+
+func TestParseInvalidBytesFunctions(t *testing.T) {
+	state := newGeneratorState(0)
+	for _, p := range []string{
+		"{bytes}[hex(zz)]{1}",
+		"{bytes}[base64(!)]{1}",
+		"{bytes}[random_bytes(4,1)]{1}",
+		"{bytes}[random_bytes(1)]{1}",
+	} {
+		if _, err := parsePattern(p, state); err == nil {
+			t.Errorf("the pattern %s should be invalid", p)
+		}
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	state := newGeneratorState(0)
+	p := mustParsePattern(t, "{string}[ a-z | uuid() | test ]{1}< 1.5 | 2 | 3 >", state)
+	weights := p.content[0].weights
+	if len(weights) != 3 || weights[0] != 1.5 || weights[1] != 2 || weights[2] != 3 {
+		t.Fail()
+	}
+	if p.content[0].options[2]()[0] != "test" {
+		t.Fail()
+	}
+	// one weight for each option
+	if _, err := parsePattern("{string}[a|b]{1}<1>", state); err == nil {
+		t.Fail()
+	}
+	// weights must be positive
+	if _, err := parsePattern("{string}[a|b]{1}<0|1>", state); err == nil {
+		t.Fail()
+	}
+	if _, err := parsePattern("{string}[a|b]{1}<-1|1>", state); err == nil {
+		t.Fail()
+	}
+	// the colons are part of the constants
+	p = mustParsePattern(t, "{string}[10:30|11:45]{1}", state)
+	if p.content[0].weights != nil || p.content[0].options[0]()[0] != "10:30" || p.content[0].options[1]()[0] != "11:45" {
+		t.Errorf("expected the constants 10:30 and 11:45")
+	}
+}
+
+func TestParseSequencesWithCount(t *testing.T) {
+	state := newGeneratorState(0)
+	for _, p := range []string{
+		"{string}[sequence(1,1)]{3}",
+		"{string}[sequence_by_key(1,1)]{1,2}",
+		"{string}[a|sequence(1,1)]{0,1}",
+	} {
+		if _, err := parsePattern(p, state); err == nil {
+			t.Errorf("the pattern %s should be invalid", p)
+		}
+	}
+}
+
+func TestParseUnknownFunctionsAsConstants(t *testing.T) {
+	state := newGeneratorState(0)
+	p := mustParsePattern(t, "{string}[f(x)|uid()]{1}", state)
+	if p.content[0].options[0]()[0] != "f(x)" || p.content[0].options[1]()[0] != "uid()" {
+		t.Errorf("expected the constants f(x) and uid()")
+	}
+}
+
+func TestParseInvalidNumericFunctions(t *testing.T) {
+	state := newGeneratorState(0)
+	for _, p := range []string{
+		"{int}[range(10,1)]{1}",
+		"{int}[range(1.2,1.8)]{1}",
+		"{int}[range(a,1)]{1}",
+		"{double}[normal(1,-1)]{1}",
+		"{double}[exponential(0)]{1}",
+		"{int}[zipf(1,1,10)]{1}",
+		// out of the int range
+		"{int}[range(3000000000,3000000001)]{1}",
+		"{int}[range(-3000000000,0)]{1}",
+		"{int}[zipf(2,1,3000000000)]{1}",
+	} {
+		if _, err := parsePattern(p, state); err == nil {
+			t.Errorf("the pattern %s should be invalid", p)
+		}
+	}
+}
@@ -0,0 +1,607 @@
+package avrogen
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	c "github.com/andrewinci/rap/configuration"
+	"github.com/hamba/avro"
+)
+
+// plan compiled once from the schema and the rules. The generators
+// of each path are resolved at compile time and the records are
+// written directly in the avro binary format
+type generationPlan struct {
+	root     planNode
+	encoders *encoderCompiler
+	// build the values of the records, required by the derived
+	// fields, the conditional rules and the published fields
+	values bool
+	// buffer reused to encode the records
+	buf []byte
+}
+
+// node of the plan: generates the value at a path of the schema and
+// appends its encoding to the buffer. The value is only returned if
+// the plan builds the values, or if the node generates a leaf value
+type planNode func(buf []byte) ([]byte, interface{}, error)
+
+func errorNode(err error) planNode {
+	return func(buf []byte) ([]byte, interface{}, error) { return buf, nil, err }
+}
+
+// compile the schema keeping track of the depth, i.e. the
+// number of references to named records followed so far
+func (g avroGen) compileNested(schema avro.Schema, fieldPath string, depth int) planNode {
+	if schema.Type() == avro.Ref {
+		// a reference to a record already defined, this is
+		// how recursive schemas are represented
+		if depth >= g.maxDepth {
+			// not reachable, reported by checkPlan
+			return errorNode(fmt.Errorf("max depth %d reached at path %s: recursive fields need to be nullable, an array or a map", g.maxDepth, fieldPath))
+		}
+		// compiled on first use, so that the recursive
+		// schemas are compiled only up to the depth reached
+		var node planNode
+		ref := schema.(*avro.RefSchema).Schema()
+		return func(buf []byte) ([]byte, interface{}, error) {
+			if node == nil {
+				node = g.compileNested(ref, fieldPath, depth+1)
+			}
+			return node(buf)
+		}
+	}
+	if branches, ok := g.conditionalRules[fieldPath]; ok {
+		return g.compileConditional(schema, fieldPath, depth, branches)
+	}
+	return g.compileType(schema, fieldPath, depth)
+}
+
+// check the errors of the plan that would otherwise be reported
+// only when a record is generated: the cyclic dependencies between
+// the fields, the invalid defaults and the recursive fields that can
+// reach the max depth without a nullable union, an array or a map
+func (g avroGen) checkPlan(schema avro.Schema, fieldPath string, depth int, checked map[string]bool) error {
+	if schema.Type() == avro.Ref {
+		if depth >= g.maxDepth {
+			return fmt.Errorf("max depth %d reached at path %s: recursive fields need to be nullable, an array or a map", g.maxDepth, fieldPath)
+		}
+		return g.checkPlan(schema.(*avro.RefSchema).Schema(), fieldPath, depth+1, checked)
+	}
+	// without rules at or below the path, the same
+	// schema at the same depth has the same plan
+	if named, ok := schema.(avro.NamedSchema); ok && !g.ruledPaths[fieldPath] {
+		key := fmt.Sprintf("%s@%d", named.FullName(), depth)
+		if checked[key] {
+			return nil
+		}
+		checked[key] = true
+	}
+	switch schema.Type() {
+	case avro.Record:
+		fields, err := g.sortFields(schema.(*avro.RecordSchema), fieldPath)
+		if err != nil {
+			return err
+		}
+		for _, f := range fields {
+			path := fieldPath + "." + f.Name()
+			if g.profile != c.Random && g.profile != "" && f.HasDefault() && !g.ruledPaths[path] {
+				if _, err := convertDefault(f.Type(), f.Default()); err != nil {
+					return fmt.Errorf("invalid default at path %s, %s", path, err.Error())
+				}
+				continue
+			}
+			if err := g.checkPlan(f.Type(), path, depth, checked); err != nil {
+				return err
+			}
+		}
+	case avro.Array:
+		if depth < g.maxDepth {
+			return g.checkPlan(schema.(*avro.ArraySchema).Items(), fieldPath, depth, checked)
+		}
+	case avro.Map:
+		if depth < g.maxDepth {
+			return g.checkPlan(schema.(*avro.MapSchema).Values(), fieldPath+".values()", depth, checked)
+		}
+	case avro.Union:
+		union := schema.(*avro.UnionSchema)
+		if _, ok := g.generatorsRepo[fieldPath]; ok || (depth >= g.maxDepth && isNullable(union)) {
+			return nil
+		}
+		for _, t := range union.Types() {
+			path := fieldPath
+			for _, n := range unionTypeNames(t) {
+				if g.ruledPaths[fieldPath+"."+n] {
+					path += "." + n
+					break
+				}
+			}
+			if err := g.checkPlan(t, path, depth, checked); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// generate the field using the generator of the first branch
+// whose condition is satisfied by the partially generated record
+func (g avroGen) compileConditional(schema avro.Schema, fieldPath string, depth int, branches []ruleBranch) planNode {
+	fallback := g.compileType(schema, fieldPath, depth)
+	encode := g.plan.encoders.compile(schema)
+	// the types generated by the `not_null` branches of the unions
+	var notNullTypes []int
+	var notNullNodes []planNode
+	var notNullNames []string
+	if union, ok := schema.(*avro.UnionSchema); ok {
+		for i, t := range union.Types() {
+			if t.Type() == avro.Null {
+				continue
+			}
+			// the conditional rule is already evaluated, skip
+			// compileNested to not evaluate it again
+			nestedDepth := depth
+			if t.Type() == avro.Ref {
+				nestedDepth++
+			}
+			name, _ := unionTypeName(t)
+			notNullTypes = append(notNullTypes, i)
+			notNullNodes = append(notNullNodes, g.compileType(derefSchema(t), fieldPath, nestedDepth))
+			notNullNames = append(notNullNames, name)
+		}
+	}
+	return func(buf []byte) ([]byte, interface{}, error) {
+		branch, ok := pickBranch(branches, g.state.record.view())
+		switch {
+		case !ok:
+			// no condition satisfied, fallback to the default generation
+			return fallback(buf)
+		case branch.gen != nil:
+			return g.writeGenerated(buf, branch.gen, encode, fieldPath)
+		case branch.target == nullTarget:
+			buf, err := encode(buf, nil)
+			return buf, nil, err
+		case schema.Type() == avro.Union:
+			// pick a random type among the non null options
+			if len(notNullTypes) == 0 {
+				return buf, nil, fmt.Errorf("no non null type available in the union at path %s", fieldPath)
+			}
+			i := g.state.random.Intn(len(notNullTypes))
+			buf, res, err := notNullNodes[i](appendLong(buf, int64(notNullTypes[i])))
+			return buf, g.wrapUnionValue(notNullNames[i], res), err
+		default:
+			// any non union type is not null
+			return fallback(buf)
+		}
+	}
+}
+
+// compile the schema with the generators of the path or
+// of the type, ignoring the conditional rules
+func (g avroGen) compileType(schema avro.Schema, fieldPath string, depth int) planNode {
+	switch schema.Type() {
+	case avro.Record:
+		return g.compileRecord(schema.(*avro.RecordSchema), fieldPath, depth)
+	case avro.Array:
+		return g.compileArray(schema.(*avro.ArraySchema), fieldPath, depth)
+	case avro.Map:
+		return g.compileMap(schema.(*avro.MapSchema), fieldPath, depth)
+	case avro.Fixed:
+		return g.compileFixed(schema.(*avro.FixedSchema), fieldPath)
+	}
+	encode := g.plan.encoders.compile(schema)
+	if fieldGen, ok := g.generatorsRepo[fieldPath]; ok {
+		return g.leafNode(fieldGen, encode, fieldPath)
+	}
+	// logical types take precedence over the underlying avro type
+	if logicalType := getLogicalType(schema); logicalType != "" {
+		if logicalGen, ok := g.generatorsRepo[string(logicalType)]; ok {
+			return g.leafNode(logicalGen, encode, fieldPath)
+		}
+		// no customization found for the decimal, generate a random
+		// value that respects precision and scale
+		if logicalType == avro.Decimal {
+			decimal := schema.(avro.LogicalTypeSchema).Logical().(*avro.DecimalLogicalSchema)
+			return g.leafNode(func() (interface{}, error) { return g.generateRandomDecimal(decimal) }, encode, fieldPath)
+		}
+	}
+	if typeGen, ok := g.generatorsRepo[string(schema.Type())]; ok {
+		return g.leafNode(typeGen, encode, fieldPath)
+	}
+	switch schema.Type() {
+	case avro.Union:
+		// no customization found for the union field, pick a random type in the union
+		return g.compileUnion(schema.(*avro.UnionSchema), fieldPath, depth)
+	case avro.Enum:
+		// no customization found for the enum field, pick a random symbol
+		symbols := schema.(*avro.EnumSchema).Symbols()
+		return func(buf []byte) ([]byte, interface{}, error) {
+			i := g.state.random.Intn(len(symbols))
+			return appendLong(buf, int64(i)), symbols[i], nil
+		}
+	}
+	return errorNode(fmt.Errorf("no generator found for type %s, path %s", string(schema.Type()), fieldPath))
+}
+
+// node that encodes the value of the generator
+func (g avroGen) leafNode(gen fieldGen, encode valueEncoder, fieldPath string) planNode {
+	return func(buf []byte) ([]byte, interface{}, error) {
+		return g.writeGenerated(buf, gen, encode, fieldPath)
+	}
+}
+
+func (g avroGen) writeGenerated(buf []byte, gen fieldGen, encode valueEncoder, fieldPath string) ([]byte, interface{}, error) {
+	res, err := gen()
+	if err != nil {
+		return buf, nil, err
+	}
+	buf, err = encode(buf, res)
+	if err != nil {
+		return buf, nil, fmt.Errorf("invalid value generated at path %s, %s", fieldPath, err.Error())
+	}
+	return buf, res, nil
+}
+
+// wrap the value into a map with key the type name,
+// same as the avro json syntax
+func (g avroGen) wrapUnionValue(name string, value interface{}) interface{} {
+	if name == "" || !g.plan.values {
+		return value
+	}
+	return map[string]interface{}{name: value}
+}
+
+func (g avroGen) compileRecord(schema *avro.RecordSchema, fieldPath string, depth int) planNode {
+	fields, err := g.sortFields(schema, fieldPath)
+	if err != nil {
+		// not reachable, reported by checkPlan
+		return errorNode(err)
+	}
+	// the fields are generated in the order of the dependencies
+	// and need to be written in the order of the schema
+	reordered := false
+	order := make([]int, len(fields))
+	nodes := make([]planNode, len(fields))
+	for i, f := range fields {
+		for j, s := range schema.Fields() {
+			if s == f {
+				order[j] = i
+				reordered = reordered || i != j
+			}
+		}
+		path := fieldPath + "." + f.Name()
+		// use the schema default unless a rule is specified for the field
+		if g.profile != c.Random && g.profile != "" && f.HasDefault() && !g.ruledPaths[path] {
+			nodes[i] = g.compileDefault(f, path)
+			continue
+		}
+		nodes[i] = g.compileNested(f.Type(), path, depth)
+	}
+	starts := make([]int, len(fields)+1)
+	var scratch []byte
+	return func(buf []byte) ([]byte, interface{}, error) {
+		var res map[string]interface{}
+		if g.plan.values {
+			res = make(map[string]interface{}, len(fields))
+			// make the partially generated record available to the derived fields
+			g.state.record.frames = append(g.state.record.frames, recordFrame{path: fieldPath, record: res})
+			defer func() { g.state.record.frames = g.state.record.frames[:len(g.state.record.frames)-1] }()
+		}
+		start := len(buf)
+		for i, node := range nodes {
+			starts[i] = len(buf)
+			var value interface{}
+			var err error
+			if buf, value, err = node(buf); err != nil {
+				return buf, nil, err
+			}
+			if res != nil {
+				res[fields[i].Name()] = value
+			}
+		}
+		starts[len(fields)] = len(buf)
+		if reordered {
+			scratch = append(scratch[:0], buf[start:]...)
+			buf = buf[:start]
+			for _, i := range order {
+				buf = append(buf, scratch[starts[i]-start:starts[i+1]-start]...)
+			}
+		}
+		if res == nil {
+			return buf, nil, nil
+		}
+		return buf, res, nil
+	}
+}
+
+// node that always writes the default of the field
+func (g avroGen) compileDefault(f *avro.Field, fieldPath string) planNode {
+	value, err := convertDefault(f.Type(), f.Default())
+	if err != nil {
+		return errorNode(fmt.Errorf("invalid default at path %s, %s", fieldPath, err.Error()))
+	}
+	encoded, err := g.plan.encoders.compile(f.Type())(nil, value)
+	if err != nil {
+		return errorNode(fmt.Errorf("invalid default at path %s, %s", fieldPath, err.Error()))
+	}
+	return func(buf []byte) ([]byte, interface{}, error) {
+		return append(buf, encoded...), value, nil
+	}
+}
+
+func (g avroGen) compileUnion(schema *avro.UnionSchema, fieldPath string, depth int) planNode {
+	types := schema.Types()
+	nullable := isNullable(schema)
+	nullIndex := 0
+	// index of the types by name, used by the explicit selection
+	indexes := map[string]int{}
+	// the types with a rule for their nested fields, e.g. `.field.TypeName.nested`
+	var ruledTypes []int
+	nodes := make([]planNode, len(types))
+	names := make([]string, len(types))
+	for i, t := range types {
+		if t.Type() == avro.Null {
+			nullIndex = i
+		}
+		// the fields of the named types are addressed with the
+		// type name only when there are rules for them
+		path := fieldPath
+		for _, n := range unionTypeNames(t) {
+			indexes[n] = i
+			if g.ruledPaths[fieldPath+"."+n] && path == fieldPath {
+				path += "." + n
+			}
+		}
+		if t.Type() != avro.Null && path != fieldPath {
+			ruledTypes = append(ruledTypes, i)
+		}
+		nodes[i] = g.compileNested(t, path, depth)
+		names[i], _ = unionTypeName(t)
+	}
+
+	// explicit selection of the type
+	unionGen, hasUnionGen := g.generatorsRepo[fieldPath+".union()"]
+	unionBranches, isConditional := g.conditionalRules[fieldPath+".union()"]
+
+	nullProbability, hasNullProbability := g.nullProbabilities[fieldPath]
+	minimalNull := !hasNullProbability && len(ruledTypes) == 0 && g.profile == c.Minimal && nullable
+	if !hasNullProbability && g.nullProbability != nil {
+		nullProbability, hasNullProbability = *g.nullProbability, true
+	}
+	var candidates []int
+	for i, t := range types {
+		// the null probability is already taken into account
+		if !(nullable && hasNullProbability && t.Type() == avro.Null) {
+			candidates = append(candidates, i)
+		}
+	}
+
+	// return the index of the union type to generate, -1 for null
+	pick := func() (int, error) {
+		gen, ok := unionGen, hasUnionGen
+		if isConditional {
+			branch, matched := pickBranch(unionBranches, g.state.record.view())
+			gen, ok = branch.gen, matched && branch.gen != nil
+		}
+		if ok {
+			rawName, err := gen()
+			if err != nil {
+				return 0, err
+			}
+			name, ok := rawName.(string)
+			if !ok {
+				return 0, fmt.Errorf("the union generator at path %s needs to generate a string", fieldPath)
+			}
+			i, found := indexes[name]
+			if !found {
+				return 0, fmt.Errorf("the union at path %s has no type %s", fieldPath, name)
+			}
+			return i, nil
+		}
+		if minimalNull {
+			return -1, nil
+		}
+		if nullable && hasNullProbability && g.state.random.Float64() < nullProbability {
+			return -1, nil
+		}
+		if len(ruledTypes) > 0 {
+			return ruledTypes[g.state.random.Intn(len(ruledTypes))], nil
+		}
+		// pick a random type among the union options
+		return candidates[g.state.random.Intn(len(candidates))], nil
+	}
+
+	return func(buf []byte) ([]byte, interface{}, error) {
+		// stop the recursion when the max depth is reached
+		if depth >= g.maxDepth && nullable {
+			return appendLong(buf, int64(nullIndex)), nil, nil
+		}
+		i, err := pick()
+		if err != nil {
+			return buf, nil, err
+		}
+		if i < 0 {
+			return appendLong(buf, int64(nullIndex)), nil, nil
+		}
+		buf, res, err := nodes[i](appendLong(buf, int64(i)))
+		return buf, g.wrapUnionValue(names[i], res), err
+	}
+}
+
+func (g avroGen) compileArray(schema *avro.ArraySchema, fieldPath string, depth int) planNode {
+	length := g.compileLen(fieldPath, depth)
+	items := g.compileNested(schema.Items(), fieldPath, depth)
+	return func(buf []byte) ([]byte, interface{}, error) {
+		n, err := length()
+		if err != nil {
+			return buf, nil, err
+		}
+		if n > 0 {
+			buf = appendLong(buf, int64(n))
+		}
+		var array []interface{}
+		for i := 0; i < n; i++ {
+			var item interface{}
+			if buf, item, err = items(buf); err != nil {
+				return buf, nil, err
+			}
+			if g.plan.values {
+				array = append(array, item)
+			}
+		}
+		buf = append(buf, 0)
+		if !g.plan.values {
+			return buf, nil, nil
+		}
+		return buf, array, nil
+	}
+}
+
+func (g avroGen) compileMap(schema *avro.MapSchema, fieldPath string, depth int) planNode {
+	length := g.compileLen(fieldPath, depth)
+	keys := g.compileNested(avro.NewPrimitiveSchema(avro.String, nil), fieldPath+".keys()", 0)
+	values := g.compileNested(schema.Values(), fieldPath+".values()", depth)
+	// offsets of the entries and position of the keys,
+	// used to remove the duplicated keys
+	var starts []int
+	positions := map[string]int{}
+	var scratch []byte
+	return func(buf []byte) ([]byte, interface{}, error) {
+		n, err := length()
+		if err != nil {
+			return buf, nil, err
+		}
+		start := len(buf)
+		starts = starts[:0]
+		for k := range positions {
+			delete(positions, k)
+		}
+		var res map[string]interface{}
+		if g.plan.values {
+			res = map[string]interface{}{}
+		}
+		for i := 0; i < n; i++ {
+			starts = append(starts, len(buf))
+			var key, value interface{}
+			if buf, key, err = keys(buf); err != nil {
+				return buf, nil, err
+			}
+			keyString, ok := key.(string)
+			if !ok {
+				return buf, nil, fmt.Errorf("the keys of the map %s need to be strings", fieldPath)
+			}
+			if buf, value, err = values(buf); err != nil {
+				return buf, nil, err
+			}
+			positions[keyString] = i
+			if res != nil {
+				res[keyString] = value
+			}
+		}
+		starts = append(starts, len(buf))
+		count := n
+		if len(positions) < n {
+			// duplicated keys override the previous value
+			scratch = append(scratch[:0], buf[start:]...)
+			buf = buf[:start]
+			for i := 0; i < n; i++ {
+				entry := scratch[starts[i]-start : starts[i+1]-start]
+				if positions[string(decodeStringPrefix(entry))] == i {
+					buf = append(buf, entry...)
+				}
+			}
+			count = len(positions)
+		}
+		if count > 0 {
+			// the count precedes the entries
+			var raw [binary.MaxVarintLen64]byte
+			header := appendLong(raw[:0], int64(count))
+			buf = append(buf, header...)
+			copy(buf[start+len(header):], buf[start:len(buf)-len(header)])
+			copy(buf[start:], header)
+		}
+		buf = append(buf, 0)
+		if res == nil {
+			return buf, nil, nil
+		}
+		return buf, res, nil
+	}
+}
+
+// return the string at the beginning of the avro encoded data
+func decodeStringPrefix(data []byte) []byte {
+	var length uint64
+	var shift uint
+	i := 0
+	for ; i < len(data); i++ {
+		length |= uint64(data[i]&0x7f) << shift
+		shift += 7
+		if data[i]&0x80 == 0 {
+			break
+		}
+	}
+	n := int64(length>>1) ^ -int64(length&1)
+	return data[i+1 : i+1+int(n)]
+}
+
+// compile the generation of the len of an array or map
+func (g avroGen) compileLen(fieldPath string, depth int) func() (int, error) {
+	// check if a len generator is specified
+	gen, ok := g.generatorsRepo[fieldPath+".len()"]
+	return func() (int, error) {
+		// stop the recursion when the max depth is reached
+		if depth >= g.maxDepth {
+			return 0, nil
+		}
+		if !ok && g.profile == c.Minimal {
+			return 0, nil
+		}
+		if !ok {
+			return g.state.random.Intn(10), nil
+		}
+		tmp, err := gen()
+		if err != nil {
+			return 0, err
+		}
+		length, ok := tmp.(int)
+		if !ok || length < 0 {
+			return 0, fmt.Errorf("the generator of %s.len() needs to generate a non negative int", fieldPath)
+		}
+		return length, nil
+	}
+}
+
+func (g avroGen) compileFixed(schema *avro.FixedSchema, fieldPath string) planNode {
+	encode := g.plan.encoders.compile(schema)
+	// check the generators in order of priority:
+	// field path, logical type, fixed name
+	gen, ok := g.generatorsRepo[fieldPath]
+	if !ok && schema.Logical() != nil {
+		gen, ok = g.generatorsRepo[string(schema.Logical().Type())]
+		if !ok && schema.Logical().Type() == avro.Decimal {
+			decimal := schema.Logical().(*avro.DecimalLogicalSchema)
+			gen, ok = func() (interface{}, error) { return g.generateRandomDecimal(decimal) }, true
+		}
+	}
+	if !ok {
+		gen, ok = g.generatorsRepo[schema.FullName()]
+	}
+	if !ok {
+		gen, ok = g.generatorsRepo[schema.Name()]
+	}
+	if !ok {
+		gen = defaultFixedFieldGen(schema, g.state)
+	}
+	return func(buf []byte) ([]byte, interface{}, error) {
+		buf, res, err := g.writeGenerated(buf, gen, encode, fieldPath)
+		if err != nil {
+			return buf, nil, err
+		}
+		// the bytes pattern returns a slice that need to be
+		// converted into an array of the fixed size
+		if value, ok := res.([]byte); ok && g.plan.values {
+			res, err = toFixed(value, schema)
+		}
+		return buf, res, err
+	}
+}
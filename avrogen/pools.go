@@ -0,0 +1,243 @@
+package avrogen
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	c "github.com/andrewinci/rap/configuration"
+)
+
+// max number of values kept in a pool, the
+// oldest values are replaced by the new ones
+const maxPoolSize = 10000
+
+// named pools of values published by the producers
+// and drawn by the generators of other producers.
+// The pools are safe for concurrent use.
+type ValuePools struct {
+	lock  sync.Mutex
+	cond  *sync.Cond
+	pools map[string]*valuePool
+}
+
+type valuePool struct {
+	values []string
+	// index of the next value to replace once the pool is full
+	next int
+	// number of generators that can still publish into the pool
+	publishers int
+}
+
+func NewValuePools() *ValuePools {
+	res := &ValuePools{pools: map[string]*valuePool{}}
+	res.cond = sync.NewCond(&res.lock)
+	return res
+}
+
+func (p *ValuePools) get(name string) *valuePool {
+	pool, ok := p.pools[name]
+	if !ok {
+		pool = &valuePool{}
+		p.pools[name] = pool
+	}
+	return pool
+}
+
+// register a generator that publishes into the pool
+func (p *ValuePools) register(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.get(name).publishers++
+}
+
+// notify that a generator stopped publishing into the pool
+func (p *ValuePools) unregister(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.get(name).publishers--
+	p.cond.Broadcast()
+}
+
+func (p *ValuePools) publish(name string, value string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pool := p.get(name)
+	if len(pool.values) < maxPoolSize {
+		pool.values = append(pool.values, value)
+	} else {
+		pool.values[pool.next] = value
+	}
+	pool.next = (pool.next + 1) % maxPoolSize
+	p.cond.Broadcast()
+}
+
+// draw a value from the pool. If skew is 0 the values are drawn uniformly,
+// otherwise the most recent values are more likely to be drawn accordingly
+// to a Zipf distribution with exponent skew.
+// If the pool is empty, wait for a publisher unless wait is false.
+func (p *ValuePools) draw(name string, skew float64, random *rand.Rand, wait bool) (string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	pool, ok := p.pools[name]
+	if !ok {
+		return "", fmt.Errorf("no producer publishes into the pool %s", name)
+	}
+	for wait && len(pool.values) == 0 && pool.publishers > 0 {
+		p.cond.Wait()
+	}
+	n := len(pool.values)
+	if n == 0 {
+		return "", fmt.Errorf("the pool %s is empty", name)
+	}
+	if skew == 0 {
+		return pool.values[random.Intn(n)], nil
+	}
+	// 0 is the most recent value
+	i := 0
+	if n > 1 {
+		i = int(rand.NewZipf(random, skew, 1, uint64(n-1)).Uint64())
+	}
+	return pool.values[(pool.next-1-i+2*n)%n], nil
+}
+
+// return an error if a pool drawn by a producer has no publisher, or if
+// the producers wait for each other's pools, e.g. A draws from a pool
+// published by B and B from a pool published by A. The producers would
+// fail at the first draw or wait forever for the first value
+func CheckPools(producers []c.ProducerConfiguration) error {
+	for _, p := range producers {
+		for _, pool := range drawnPools(p.Avro) {
+			published := false
+			for _, other := range producers {
+				published = published || publishes(other.Avro, pool)
+			}
+			if !published {
+				return fmt.Errorf("no producer publishes into the pool %s drawn by the producer %s", pool, p.Name)
+			}
+		}
+	}
+	// producers waiting for the producer at the index
+	waiting := make([][]int, len(producers))
+	for i, p := range producers {
+		for _, pool := range drawnPools(p.Avro) {
+			for j, other := range producers {
+				if i != j && publishes(other.Avro, pool) && !publishes(p.Avro, pool) {
+					waiting[i] = append(waiting[i], j)
+				}
+			}
+		}
+	}
+	// depth first search of the cycles
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(producers))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		state[i] = visiting
+		path = append(path, producers[i].Name)
+		for _, j := range waiting[i] {
+			switch state[j] {
+			case visiting:
+				return fmt.Errorf("the producers %s -> %s wait for the values of each other's pools", strings.Join(path, " -> "), producers[j].Name)
+			case unvisited:
+				if err := visit(j); err != nil {
+					return err
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return nil
+	}
+	for i := range producers {
+		if state[i] == unvisited {
+			if err := visit(i); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// return the names of the pools drawn by the generators
+func drawnPools(config c.AvroGenConfiguration) []string {
+	var re = regexp.MustCompile(`^\{[a-z]+\}pool\(([^,)]*)`)
+	var res []string
+	for _, g := range config.Generators {
+		if matches := re.FindStringSubmatch(g); matches != nil {
+			res = append(res, strings.Trim(matches[1], " "))
+		}
+	}
+	return res
+}
+
+func publishes(config c.AvroGenConfiguration, pool string) bool {
+	for _, p := range config.Publish {
+		if p == pool {
+			return true
+		}
+	}
+	return false
+}
+
+// parse a generator that draws from a pool like `{string}pool(customers)`
+// or `{long}pool(customers, 1.5)`. Returns false if the raw generator is
+// not a pool generator.
+func newPoolFieldGen(raw string, state *generatorState, pools *ValuePools, published map[string]bool) (fieldGen, bool, error) {
+	var re = regexp.MustCompile(`^\{([a-z]+)\}pool\((.*)\)$`)
+	matches := re.FindStringSubmatch(raw)
+	if matches == nil {
+		return nil, false, nil
+	}
+	avroType := matches[1]
+	if _, err := parseValue(avroType, "0"); err != nil {
+		return nil, true, err
+	}
+	args := strings.Split(matches[2], ",")
+	name := strings.Trim(args[0], " ")
+	if name == "" || len(args) > 2 {
+		return nil, true, fmt.Errorf("invalid pool generator %s", raw)
+	}
+	skew := 0.0
+	if len(args) == 2 {
+		var err error
+		skew, err = strconv.ParseFloat(strings.Trim(args[1], " "), 64)
+		if err != nil || skew <= 1 {
+			return nil, true, fmt.Errorf("the skew of the pool generator needs to be a number greater than 1")
+		}
+	}
+	if pools == nil {
+		return nil, true, fmt.Errorf("value pools not available")
+	}
+	// don't wait for values published by the generator itself
+	wait := !published[name]
+	return func() (interface{}, error) {
+		value, err := pools.draw(name, skew, state.random, wait)
+		if err != nil {
+			return nil, err
+		}
+		return parseValue(avroType, value)
+	}, true, nil
+}
+
+// convert a generated value into the pool representation
+func toPoolValue(value interface{}) string {
+	// unwrap the values of the unions
+	if m, ok := value.(map[string]interface{}); ok && len(m) == 1 {
+		for _, v := range m {
+			value = v
+		}
+	}
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+	return fmt.Sprint(value)
+}
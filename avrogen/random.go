@@ -0,0 +1,34 @@
+package avrogen
+
+// source of random numbers (splitmix64) that can be re-seeded
+// in constant time. The generators are re-seeded at each record
+// to make every record a function of the seed and its index
+type splitMixSource struct {
+	state uint64
+}
+
+func (s *splitMixSource) Seed(seed int64) {
+	s.state = uint64(seed)
+}
+
+func (s *splitMixSource) Uint64() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	return mix64(s.state)
+}
+
+func (s *splitMixSource) Int63() int64 {
+	return int64(s.Uint64() >> 1)
+}
+
+// finalizer of splitmix64, spreads the bits of
+// close inputs (e.g. consecutive indexes) over the output
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// seed of the generators for the record at the index
+func recordSeed(seed int64, index int64) int64 {
+	return int64(mix64(uint64(seed) ^ mix64(uint64(index)+0x9e3779b97f4a7c15)))
+}
@@ -0,0 +1,183 @@
+package avrogen
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// max number of repetitions generated for
+// the unbounded operators like `*`, `+` and `{n,}`
+const regexMaxRepeat = 10
+
+// classes larger than this, e.g. `.` or `[^a]`, are restricted
+// to the printable ascii characters when possible
+const regexLargeClass = 0x2000
+
+// generator of strings matching a regular expression
+// with the go syntax, e.g. `^[A-Z]{2}\d{2}[A-Z0-9]{1,30}$`
+type regexGen struct {
+	re     *syntax.Regexp
+	random *rand.Rand
+}
+
+func newRegexGen(pattern string, random *rand.Rand) (*regexGen, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return nil, err
+	}
+	re = re.Simplify()
+	if err := checkRegex(re, true, true); err != nil {
+		return nil, err
+	}
+	return &regexGen{re: re, random: random}, nil
+}
+
+// return an error if the regex contains operators that
+// cannot be used to generate a string. The anchors are only
+// supported at the start and at the end of the regex, where
+// they are always satisfied by the generated string
+func checkRegex(re *syntax.Regexp, atStart bool, atEnd bool) error {
+	switch re.Op {
+	case syntax.OpNoMatch:
+		return fmt.Errorf("the regex doesn't match any string")
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return fmt.Errorf("the word boundaries `\\b` and `\\B` are not supported")
+	case syntax.OpBeginLine, syntax.OpBeginText:
+		if !atStart {
+			return fmt.Errorf("the anchor `^` is only supported at the start of the regex")
+		}
+	case syntax.OpEndLine, syntax.OpEndText:
+		if !atEnd {
+			return fmt.Errorf("the anchor `$` is only supported at the end of the regex")
+		}
+	case syntax.OpCapture, syntax.OpAlternate:
+		for _, s := range re.Sub {
+			if err := checkRegex(s, atStart, atEnd); err != nil {
+				return err
+			}
+		}
+	case syntax.OpConcat:
+		for i, s := range re.Sub {
+			// the previous and the next anchors don't move the position
+			subStart := atStart && allAnchors(re.Sub[:i], syntax.OpBeginLine, syntax.OpBeginText)
+			subEnd := atEnd && allAnchors(re.Sub[i+1:], syntax.OpEndLine, syntax.OpEndText)
+			if err := checkRegex(s, subStart, subEnd); err != nil {
+				return err
+			}
+		}
+	default:
+		// the repetitions move the position after the first one
+		for _, s := range re.Sub {
+			if err := checkRegex(s, false, false); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// return true if all the regexes are the given anchors
+func allAnchors(res []*syntax.Regexp, line syntax.Op, text syntax.Op) bool {
+	for _, re := range res {
+		if re.Op != line && re.Op != text {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *regexGen) generate() string {
+	var res strings.Builder
+	g.write(&res, g.re)
+	return res.String()
+}
+
+func (g *regexGen) write(res *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		for _, r := range re.Rune {
+			res.WriteRune(r)
+		}
+	case syntax.OpCharClass:
+		res.WriteRune(g.pickRune(re.Rune))
+	case syntax.OpAnyCharNotNL, syntax.OpAnyChar:
+		res.WriteRune(g.pickRune([]rune{' ', '~'}))
+	case syntax.OpCapture:
+		g.write(res, re.Sub[0])
+	case syntax.OpConcat:
+		for _, s := range re.Sub {
+			g.write(res, s)
+		}
+	case syntax.OpAlternate:
+		g.write(res, re.Sub[g.random.Intn(len(re.Sub))])
+	case syntax.OpStar:
+		g.repeat(res, re.Sub[0], 0, -1)
+	case syntax.OpPlus:
+		g.repeat(res, re.Sub[0], 1, -1)
+	case syntax.OpQuest:
+		g.repeat(res, re.Sub[0], 0, 1)
+	case syntax.OpRepeat:
+		g.repeat(res, re.Sub[0], re.Min, re.Max)
+	}
+	// the anchors at the start and at the end don't generate anything
+}
+
+// write the regex between min and max times,
+// a negative max means no upper bound
+func (g *regexGen) repeat(res *strings.Builder, re *syntax.Regexp, min int, max int) {
+	if max < 0 {
+		max = min + regexMaxRepeat
+	}
+	count := min + g.random.Intn(max-min+1)
+	for i := 0; i < count; i++ {
+		g.write(res, re)
+	}
+}
+
+// pick a random rune in the class,
+// expressed as a list of pairs of bounds
+func (g *regexGen) pickRune(class []rune) rune {
+	if classSize(class) > regexLargeClass {
+		if printable := intersectClass(class, ' ', '~'); len(printable) > 0 {
+			class = printable
+		}
+	}
+	r := g.random.Intn(classSize(class))
+	for i := 0; i < len(class); i += 2 {
+		size := int(class[i+1]-class[i]) + 1
+		if r < size {
+			return class[i] + rune(r)
+		}
+		r -= size
+	}
+	return unicode.ReplacementChar
+}
+
+func classSize(class []rune) int {
+	res := 0
+	for i := 0; i < len(class); i += 2 {
+		res += int(class[i+1]-class[i]) + 1
+	}
+	return res
+}
+
+// restrict the class to the runes between from and to
+func intersectClass(class []rune, from rune, to rune) []rune {
+	var res []rune
+	for i := 0; i < len(class); i += 2 {
+		lo, hi := class[i], class[i+1]
+		if lo < from {
+			lo = from
+		}
+		if hi > to {
+			hi = to
+		}
+		if lo <= hi {
+			res = append(res, lo, hi)
+		}
+	}
+	return res
+}
@@ -0,0 +1,66 @@
+package avrogen
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRegexGenerator(t *testing.T) {
+	state := newGeneratorState(0)
+	for _, r := range []string{
+		`^[A-Z]{2}\d{2}[A-Z0-9]{1,30}$`,
+		`^(foo|bar)+-\w*$`,
+		`^[^a-z]{3}\.[[:alpha:]]?$`,
+		`^.{5}$`,
+		`^\p{Greek}+\s$`,
+		`^[a-c]{2,}x*$`,
+		`(?i)^abc$`,
+		`^(^a|b$)$`,
+	} {
+		gen := mustNewFieldGen(`{string}[regex("`+r+`")]{1}`, state)
+		re := regexp.MustCompile(r)
+		for i := 0; i < 200; i++ {
+			value, err := gen()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !re.MatchString(value.(string)) {
+				t.Errorf("the value %q doesn't match the regex %s", value, r)
+			}
+		}
+	}
+}
+
+func TestRegexGeneratorIsDeterministic(t *testing.T) {
+	generate := func() string {
+		gen := mustNewFieldGen(`{string}[regex("[a-z0-9]{5,10}(@|#).*")]{1}`, newGeneratorState(42))
+		var res []string
+		for i := 0; i < 10; i++ {
+			value, _ := gen()
+			res = append(res, value.(string))
+		}
+		return strings.Join(res, ",")
+	}
+	if generate() != generate() {
+		t.Errorf("the same seed should generate the same values")
+	}
+}
+
+func TestRegexGeneratorErrors(t *testing.T) {
+	state := newGeneratorState(0)
+	for pattern, expected := range map[string]string{
+		`{string}[regex("[a-z")]{1}`:  "invalid regex of the function 'regex()', error parsing regexp: missing closing ]: `[a-z` at col 10",
+		`{string}[regex()]{1}`:        "invalid arguments () of the function 'regex()' at col 10",
+		`{string}[x|regex(a,b)]{1}`:   "invalid arguments (a,b) of the function 'regex()' at col 12",
+		`{string}[regex("\\C+")]{1}`:  "invalid regex of the function 'regex()', error parsing regexp: invalid escape sequence: `\\C` at col 10",
+		`{string}[regex("a\\bb")]{1}`: "invalid regex of the function 'regex()', the word boundaries `\\b` and `\\B` are not supported at col 10",
+		`{string}[regex("a^b")]{1}`:   "invalid regex of the function 'regex()', the anchor `^` is only supported at the start of the regex at col 10",
+		`{string}[regex("(a$)+")]{1}`: "invalid regex of the function 'regex()', the anchor `$` is only supported at the end of the regex at col 10",
+	} {
+		_, err := parsePattern(pattern, state)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected the error `%s` for the pattern %s, got `%v`", expected, pattern, err)
+		}
+	}
+}
@@ -0,0 +1,347 @@
+package avrogen
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	c "github.com/andrewinci/rap/configuration"
+	"github.com/hamba/avro"
+)
+
+// schema found at a path of the record
+type pathSchema struct {
+	schema avro.Schema
+	// the value generated at the path is used as is in
+	// the union, hence only primitive types can be used
+	inUnion bool
+}
+
+// validate the rules, the published fields and the null probabilities
+// against the schema. Returns the list of problems found.
+func validateConfiguration(schema avro.Schema, config c.AvroGenConfiguration, rules map[string][]ruleBranch, generatorReferences map[string][]string) []string {
+	exists := func(path string) bool { return len(resolvePath(schema, path)) > 0 }
+	generatorTypes := map[string]string{}
+	for k, v := range config.Generators {
+		if matches := regexp.MustCompile(`^\{([a-z]+)\}`).FindStringSubmatch(v); matches != nil {
+			generatorTypes[k] = matches[1]
+		}
+	}
+
+	var problems []string
+	for k, branches := range rules {
+		if !strings.HasPrefix(k, ".") {
+			if problem := validateTypeRule(k, branches[0].target, generatorTypes[branches[0].target], schema); problem != "" {
+				problems = append(problems, problem)
+			}
+			continue
+		}
+		schemas := resolvePath(schema, k)
+		if len(schemas) == 0 {
+			problems = append(problems, fmt.Sprintf("the path of the rule %s doesn't exist in the schema", k))
+			continue
+		}
+		for _, b := range branches {
+			if b.condition != nil {
+				if !exists(b.condition.path) {
+					problems = append(problems, fmt.Sprintf("the condition of the rule %s references the missing field %s", k, b.condition.path))
+				}
+			}
+			for _, r := range generatorReferences[b.target] {
+				if !exists(r) {
+					problems = append(problems, fmt.Sprintf("the generator %s of the rule %s references the missing field %s", b.target, k, r))
+				}
+			}
+			_, isGenerator := config.Generators[b.target]
+			switch {
+			case strings.HasSuffix(k, ".union()") && !isGenerator:
+				problems = append(problems, validateUnionTypes(k, b.target, resolvePath(schema, strings.TrimSuffix(k, ".union()")))...)
+			case b.target == nullTarget && !isGenerator:
+				if !hasType(schemas, avro.Null) {
+					problems = append(problems, fmt.Sprintf("the rule %s generates null for a field that is not nullable", k))
+				}
+			case b.target == notNullTarget && !isGenerator:
+			default:
+				genType, ok := generatorTypes[b.target]
+				if ok && !isCompatible(schemas, genType) {
+					problems = append(problems, fmt.Sprintf("the generator %s of the rule %s generates %s values, but the field is %s",
+						b.target, k, genType, describeTypes(schemas)))
+				}
+			}
+		}
+	}
+
+	problems = append(problems, validateSequences(schema, config, rules)...)
+
+	for k, v := range config.Publish {
+		if !exists(k) && k != "key" {
+			problems = append(problems, fmt.Sprintf("the path %s published into the pool %s doesn't exist in the schema", k, v))
+		}
+	}
+	for k := range config.NullProbabilities {
+		if schemas := resolvePath(schema, k); len(schemas) == 0 {
+			problems = append(problems, fmt.Sprintf("the path %s of the null probability doesn't exist in the schema", k))
+		} else if !hasType(schemas, avro.Null) {
+			problems = append(problems, fmt.Sprintf("the null probability is set for the field %s that is not nullable", k))
+		}
+	}
+	return problems
+}
+
+// the sequences follow the index of the record, hence they would generate
+// the same value when used more than once in a record. Reject the generators
+// with a sequence used by more than one rule, by the rules of the types or
+// by the rules of the fields in the arrays and the maps
+func validateSequences(schema avro.Schema, config c.AvroGenConfiguration, rules map[string][]ruleBranch) []string {
+	sequenceRules := map[string][]string{}
+	for k, branches := range rules {
+		for _, b := range branches {
+			g, ok := config.Generators[b.target]
+			if !ok || !usesFunction(g, "sequence") {
+				continue
+			}
+			if l := sequenceRules[b.target]; len(l) == 0 || l[len(l)-1] != k {
+				sequenceRules[b.target] = append(l, k)
+			}
+		}
+	}
+	var problems []string
+	for g, r := range sequenceRules {
+		sort.Strings(r)
+		switch {
+		case len(r) > 1:
+			problems = append(problems, fmt.Sprintf("the generator %s uses sequence() in more than one rule: %s", g, strings.Join(r, ", ")))
+		case r[0] == "key":
+		case !strings.HasPrefix(r[0], ".") || isRepeatedPath(schema, r[0]):
+			problems = append(problems, fmt.Sprintf("the generator %s uses sequence() in the rule %s that generates more than one value per record", g, r[0]))
+		}
+	}
+	return problems
+}
+
+// return true if more than one value is generated at the path in a
+// record, i.e. the path is in an array or in the keys or values of a map
+func isRepeatedPath(schema avro.Schema, path string) bool {
+	repeated := func(p string) bool {
+		schemas := resolvePath(schema, p)
+		return hasType(schemas, avro.Array) || hasType(schemas, avro.Map)
+	}
+	// the length is generated once, even for the arrays
+	trimmed := strings.TrimSuffix(path, ".len()")
+	if trimmed == path && repeated(path) {
+		return true
+	}
+	for i := 1; i < len(trimmed); i++ {
+		if trimmed[i] == '.' && repeated(trimmed[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// return the schemas that can be found at the path, including the
+// special paths like `.len()`, `.keys()`, `.values()` and `.union()`.
+// The path doesn't exist if no schema is returned.
+func resolvePath(schema avro.Schema, path string) []pathSchema {
+	var res []pathSchema
+	for _, s := range expandSchema(schema, false) {
+		if path == "" {
+			res = append(res, s)
+			continue
+		}
+		// the segments are matched on the full remaining path
+		// because the full names of the types contain dots
+		next := func(segment string, nested avro.Schema) {
+			if strings.HasPrefix(path, segment) && (len(path) == len(segment) || path[len(segment)] == '.') {
+				res = append(res, resolvePath(nested, path[len(segment):])...)
+			}
+		}
+		intSchema, stringSchema := avro.NewPrimitiveSchema(avro.Int, nil), avro.NewPrimitiveSchema(avro.String, nil)
+		switch schema := s.schema.(type) {
+		case *avro.RecordSchema:
+			for _, f := range schema.Fields() {
+				next("."+f.Name(), f.Type())
+			}
+		case *avro.ArraySchema:
+			next(".len()", intSchema)
+		case *avro.MapSchema:
+			next(".len()", intSchema)
+			next(".keys()", stringSchema)
+			next(".values()", schema.Values())
+		case *avro.UnionSchema:
+			next(".union()", stringSchema)
+			for _, t := range schema.Types() {
+				if t.Type() == avro.Null {
+					continue
+				}
+				for _, n := range unionTypeNames(t) {
+					next("."+n, t)
+				}
+			}
+		}
+	}
+	return res
+}
+
+// return the schemas generated at the same path of the schema:
+// the types of the unions and the items of the arrays
+func expandSchema(schema avro.Schema, inUnion bool) []pathSchema {
+	schema = derefSchema(schema)
+	res := []pathSchema{{schema: schema, inUnion: inUnion}}
+	switch s := schema.(type) {
+	case *avro.UnionSchema:
+		for _, t := range s.Types() {
+			res = append(res, expandSchema(t, true)...)
+		}
+	case *avro.ArraySchema:
+		res = append(res, expandSchema(s.Items(), false)...)
+	}
+	return res
+}
+
+// return true if the schema contains a fixed with the name
+func hasFixed(schema avro.Schema, name string, visited map[string]bool) bool {
+	schema = derefSchema(schema)
+	if named, ok := schema.(avro.NamedSchema); ok {
+		if visited[named.FullName()] {
+			return false
+		}
+		visited[named.FullName()] = true
+	}
+	switch s := schema.(type) {
+	case *avro.FixedSchema:
+		return s.Name() == name || s.FullName() == name
+	case *avro.RecordSchema:
+		for _, f := range s.Fields() {
+			if hasFixed(f.Type(), name, visited) {
+				return true
+			}
+		}
+	case *avro.UnionSchema:
+		for _, t := range s.Types() {
+			if hasFixed(t, name, visited) {
+				return true
+			}
+		}
+	case *avro.ArraySchema:
+		return hasFixed(s.Items(), name, visited)
+	case *avro.MapSchema:
+		return hasFixed(s.Values(), name, visited)
+	}
+	return false
+}
+
+// validate the rules that target a type instead of a path
+func validateTypeRule(rule string, generator string, genType string, schema avro.Schema) string {
+	logicalTypes := map[avro.LogicalType]avro.Type{
+		avro.Date:            avro.Int,
+		avro.TimeMillis:      avro.Int,
+		avro.TimeMicros:      avro.Long,
+		avro.TimestampMillis: avro.Long,
+		avro.TimestampMicros: avro.Long,
+		avro.UUID:            avro.String,
+		avro.Decimal:         avro.Bytes,
+	}
+	expected := ""
+	switch rule {
+	case "key":
+		expected = string(avro.String)
+	case string(avro.Boolean), string(avro.Int), string(avro.Long), string(avro.Float), string(avro.Double),
+		string(avro.String), string(avro.Bytes), string(avro.Null):
+		expected = rule
+	default:
+		if t, ok := logicalTypes[avro.LogicalType(rule)]; ok {
+			expected = string(t)
+			break
+		}
+		if hasFixed(schema, rule, map[string]bool{}) {
+			expected = string(avro.Bytes)
+		}
+	}
+	if expected == "" {
+		return fmt.Sprintf("the rule %s doesn't target a path, a type or a fixed of the schema", rule)
+	}
+	if genType != "" && genType != expected && !(expected == string(avro.Double) && genType == string(avro.Float)) {
+		return fmt.Sprintf("the generator %s of the rule %s generates %s values, but %s is expected", generator, rule, genType, expected)
+	}
+	return ""
+}
+
+// validate the list of types of a `.union()` rule
+func validateUnionTypes(rule string, rawTypes string, schemas []pathSchema) []string {
+	var problems []string
+	for _, t := range strings.Split(rawTypes, "|") {
+		name, _, _ := parseWeight(strings.Trim(t, " "))
+		found := false
+		for _, s := range schemas {
+			union, ok := s.schema.(*avro.UnionSchema)
+			if !ok {
+				continue
+			}
+			for _, ut := range union.Types() {
+				for _, n := range unionTypeNames(ut) {
+					found = found || n == name
+				}
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("the rule %s references the type %s that is not in the union", rule, name))
+		}
+	}
+	return problems
+}
+
+// return true if the generator type can be used
+// for at least one of the schemas
+func isCompatible(schemas []pathSchema, genType string) bool {
+	for _, s := range schemas {
+		schema := derefSchema(s.schema)
+		expected := schema.Type()
+		switch {
+		case expected == avro.Enum && !s.inUnion:
+			expected = avro.String
+		case expected == avro.Fixed && !s.inUnion:
+			expected = avro.Bytes
+		}
+		switch expected {
+		case avro.Null, avro.Boolean, avro.Int, avro.Long, avro.Float, avro.Double, avro.String, avro.Bytes:
+			if string(expected) == genType || (expected == avro.Double && genType == string(avro.Float)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasType(schemas []pathSchema, t avro.Type) bool {
+	for _, s := range schemas {
+		if s.schema.Type() == t {
+			return true
+		}
+	}
+	return false
+}
+
+// describe the types of the schemas for the error messages
+func describeTypes(schemas []pathSchema) string {
+	types := map[string]bool{}
+	for _, s := range schemas {
+		schema := derefSchema(s.schema)
+		if schema.Type() == avro.Union {
+			// the types of the union are described individually
+			continue
+		}
+		if logicalType := getLogicalType(schema); logicalType != "" {
+			types[fmt.Sprintf("%s.%s", schema.Type(), logicalType)] = true
+			continue
+		}
+		types[string(schema.Type())] = true
+	}
+	var res []string
+	for t := range types {
+		res = append(res, t)
+	}
+	sort.Strings(res)
+	return strings.Join(res, " or ")
+}
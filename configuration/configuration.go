@@ -27,11 +27,87 @@ const (
 	MTLS Security = "mtls"
 )
 
+type GenerationProfile string
+
+const (
+	// random values for every field
+	Random GenerationProfile = "random"
+	// schema default values when present, random otherwise
+	Defaults GenerationProfile = "defaults"
+	// schema default values when present, null for optional
+	// fields and empty arrays and maps
+	Minimal GenerationProfile = "minimal"
+)
+
 type ProducerConfiguration struct {
 	Name             string
 	NumberOfMessages int `yaml:"numberOfMessages"`
 	Avro             AvroGenConfiguration
 	Topic            string `yaml:"topic"`
+	// seed of the random generators of the producer,
+	// overrides the seed provided with the --seed argument
+	Seed *int64 `yaml:"seed"`
+	// index of the first record to generate, used to resume
+	// a run or to split a producer across several processes
+	StartIndex int64 `yaml:"startIndex"`
+	// number of goroutines generating the records, 1 if not set
+	Workers int `yaml:"workers"`
+	// max number of generated records waiting to be sent
+	// to the kafka client, the workers block when it is full
+	QueueSize int `yaml:"queueSize"`
+	// max rate of the records sent to kafka, unlimited if not set
+	Rate *RateConfiguration
+}
+
+type RateUnit string
+
+const (
+	// records per second
+	Messages RateUnit = "messages"
+	// bytes of the keys and values per second
+	Bytes RateUnit = "bytes"
+)
+
+type RateProfile string
+
+const (
+	// `rate` for the whole run
+	Constant RateProfile = "constant"
+	// linear change from `from` to `to` in `duration`, then `to`
+	Ramp RateProfile = "ramp"
+	// sequence of `steps`, the last rate is kept after the last step
+	Step RateProfile = "step"
+	// sine wave between `min` and `max` with the `period`, e.g. 24h
+	// for a diurnal pattern. It starts from `min`
+	Sine RateProfile = "sine"
+	// `burstRate` for `duration` at the beginning of every `period`, `rate` otherwise
+	Burst RateProfile = "burst"
+)
+
+// rate of the records over time
+type RateConfiguration struct {
+	// unit of the rates, messages (default) or bytes per second
+	Unit    RateUnit
+	Profile RateProfile
+	// rate of the constant profile and base rate of the bursts
+	Rate float64
+	// rates at the beginning and at the end of the ramp
+	From float64
+	To   float64
+	// duration of the ramp and of the bursts, e.g. 10m
+	Duration string
+	Steps    []RateStep
+	// bounds of the sine profile
+	Min float64
+	Max float64
+	// period of the sine and of the bursts, e.g. 24h
+	Period    string
+	BurstRate float64 `yaml:"burstRate"`
+}
+
+type RateStep struct {
+	Rate     float64
+	Duration string
 }
 
 type SchemaRegistryConfiguration struct {
@@ -45,6 +121,15 @@ type SaslConfiguration struct {
 	Password string
 }
 
+// simulated clock used by the time based generators
+type ClockConfiguration struct {
+	// RFC3339 time of the first record, e.g. 2022-01-01T00:00:00Z.
+	// The wall clock is used if not set
+	Start string
+	// time elapsed between two records, e.g. 100ms
+	Step string
+}
+
 type SchemaConfiguration struct {
 	Id  int
 	Raw string
@@ -61,6 +146,29 @@ type AvroGenConfiguration struct {
 	// set of rules to customize the
 	// avro generation
 	GenerationRules map[string]string `yaml:"generationRules"`
+	// max number of times a recursive record
+	// can be nested in itself
+	MaxDepth int `yaml:"maxDepth"`
+	// profile used to generate the fields
+	// without a generation rule
+	Profile GenerationProfile `yaml:"profile"`
+	// locale of the fake data generators, e.g. it_IT
+	Locale string
+	// locale to use for specific generators
+	// overrides the producer locale
+	GeneratorLocales map[string]string `yaml:"generatorLocales"`
+	// publish the generated values of the fields into the named
+	// pools, e.g. `.customerId: customers`. Use `key` for the record key
+	Publish map[string]string
+	// probability (0-1) that an optional union is generated as null.
+	// If not set, each type of the union has the same probability
+	NullProbability *float64 `yaml:"nullProbability"`
+	// null probability of specific fields, overrides the
+	// producer null probability
+	NullProbabilities map[string]float64 `yaml:"nullProbabilities"`
+	// simulated clock used by the time based generators
+	// to make the generation reproducible
+	Clock ClockConfiguration
 }
 
 // Load the configuration from the provided yaml file path
@@ -115,6 +223,72 @@ func validateConfiguration(config *Configuration) error {
 		return fmt.Errorf("validation error: security setting `%s` not supported", config.Kafka.Security)
 	}
 
+	// validate generation profiles
+	for _, p := range config.Producers {
+		switch p.Avro.Profile {
+		case "", Random, Defaults, Minimal:
+		default:
+			return fmt.Errorf("validation error: profile `%s` of the producer %s not supported", p.Avro.Profile, p.Name)
+		}
+	}
+
+	// validate the max depths of the recursive records
+	for _, p := range config.Producers {
+		if p.Avro.MaxDepth < 0 {
+			return fmt.Errorf("validation error: the max depth of the producer %s must not be negative", p.Name)
+		}
+	}
+
+	// validate the start indexes
+	for _, p := range config.Producers {
+		if p.StartIndex < 0 {
+			return fmt.Errorf("validation error: the start index of the producer %s must not be negative", p.Name)
+		}
+	}
+
+	// validate the workers and the queues
+	for _, p := range config.Producers {
+		if p.Workers < 0 {
+			return fmt.Errorf("validation error: the number of workers of the producer %s must not be negative", p.Name)
+		}
+		if p.QueueSize < 0 {
+			return fmt.Errorf("validation error: the queue size of the producer %s must not be negative", p.Name)
+		}
+		// the queue is split among the workers, each one needs room for a record
+		if p.QueueSize > 0 && p.QueueSize < p.Workers {
+			return fmt.Errorf("validation error: the queue size of the producer %s must not be less than the number of workers", p.Name)
+		}
+	}
+
+	// validate the rates
+	for _, p := range config.Producers {
+		if p.Rate == nil {
+			continue
+		}
+		switch p.Rate.Unit {
+		case "", Messages, Bytes:
+		default:
+			return fmt.Errorf("validation error: rate unit `%s` of the producer %s not supported", p.Rate.Unit, p.Name)
+		}
+		switch p.Rate.Profile {
+		case "", Constant, Ramp, Step, Sine, Burst:
+		default:
+			return fmt.Errorf("validation error: rate profile `%s` of the producer %s not supported", p.Rate.Profile, p.Name)
+		}
+	}
+
+	// validate null probabilities
+	for _, p := range config.Producers {
+		if p.Avro.NullProbability != nil && (*p.Avro.NullProbability < 0 || *p.Avro.NullProbability > 1) {
+			return fmt.Errorf("validation error: the null probability of the producer %s must be between 0 and 1", p.Name)
+		}
+		for path, probability := range p.Avro.NullProbabilities {
+			if probability < 0 || probability > 1 {
+				return fmt.Errorf("validation error: the null probability of the field %s in the producer %s must be between 0 and 1", path, p.Name)
+			}
+		}
+	}
+
 	schemaRegistryConfigured := config.Kafka.SchemaRegistry.Endpoint != ""
 	if schemaRegistryConfigured {
 		return nil
@@ -91,3 +91,133 @@ func TestValidateConfiguration_EmptyProducers(t *testing.T) {
 		t.Fail()
 	}
 }
+
+func TestValidateConfiguration_Profile(t *testing.T) {
+	c := Configuration{
+		Kafka: KafkaConfiguration{
+			ClusterEndpoint: "endpoint",
+			Security:        None,
+		},
+		Producers: []ProducerConfiguration{
+			{Avro: AvroGenConfiguration{Profile: "unknown"}},
+		}}
+	res := validateConfiguration(&c)
+	if res == nil {
+		// validation should fail because the profile is not supported
+		t.Fail()
+	}
+	c.Producers[0].Avro.Profile = Minimal
+	res = validateConfiguration(&c)
+	if res != nil {
+		t.Fail()
+	}
+}
+
+func TestValidateConfiguration_NullProbability(t *testing.T) {
+	invalid := 1.5
+	c := Configuration{
+		Kafka: KafkaConfiguration{
+			ClusterEndpoint: "endpoint",
+			Security:        None,
+		},
+		Producers: []ProducerConfiguration{
+			{Avro: AvroGenConfiguration{NullProbability: &invalid}},
+		}}
+	if validateConfiguration(&c) == nil {
+		t.Error("the null probability must be between 0 and 1")
+	}
+	valid := 0.05
+	c.Producers[0].Avro.NullProbability = &valid
+	c.Producers[0].Avro.NullProbabilities = map[string]float64{".field": -0.1}
+	if validateConfiguration(&c) == nil {
+		t.Error("the null probability of the fields must be between 0 and 1")
+	}
+	c.Producers[0].Avro.NullProbabilities[".field"] = 0
+	if validateConfiguration(&c) != nil {
+		t.Error("expected a valid configuration")
+	}
+}
+
+func TestValidateConfiguration_StartIndex(t *testing.T) {
+	c := Configuration{
+		Kafka: KafkaConfiguration{
+			ClusterEndpoint: "endpoint",
+			Security:        None,
+		},
+		Producers: []ProducerConfiguration{
+			{StartIndex: -1},
+		}}
+	if validateConfiguration(&c) == nil {
+		t.Error("the start index must not be negative")
+	}
+	c.Producers[0].StartIndex = 1000
+	if validateConfiguration(&c) != nil {
+		t.Error("expected a valid configuration")
+	}
+}
+
+func TestValidateConfiguration_MaxDepth(t *testing.T) {
+	c := Configuration{
+		Kafka: KafkaConfiguration{
+			ClusterEndpoint: "endpoint",
+			Security:        None,
+		},
+		Producers: []ProducerConfiguration{
+			{Avro: AvroGenConfiguration{MaxDepth: -1}},
+		}}
+	if validateConfiguration(&c) == nil {
+		t.Error("the max depth must not be negative")
+	}
+	c.Producers[0].Avro.MaxDepth = 3
+	if validateConfiguration(&c) != nil {
+		t.Error("expected a valid configuration")
+	}
+}
+
+func TestValidateConfiguration_Workers(t *testing.T) {
+	c := Configuration{
+		Kafka: KafkaConfiguration{
+			ClusterEndpoint: "endpoint",
+			Security:        None,
+		},
+		Producers: []ProducerConfiguration{
+			{Workers: -1},
+		}}
+	if validateConfiguration(&c) == nil {
+		t.Error("the number of workers must not be negative")
+	}
+	c.Producers[0] = ProducerConfiguration{QueueSize: -1}
+	if validateConfiguration(&c) == nil {
+		t.Error("the queue size must not be negative")
+	}
+	c.Producers[0] = ProducerConfiguration{Workers: 4, QueueSize: 3}
+	if validateConfiguration(&c) == nil {
+		t.Error("the queue size must not be less than the number of workers")
+	}
+	c.Producers[0] = ProducerConfiguration{Workers: 4, QueueSize: 1000}
+	if validateConfiguration(&c) != nil {
+		t.Error("expected a valid configuration")
+	}
+}
+
+func TestValidateConfiguration_Rate(t *testing.T) {
+	c := Configuration{
+		Kafka: KafkaConfiguration{
+			ClusterEndpoint: "endpoint",
+			Security:        None,
+		},
+		Producers: []ProducerConfiguration{
+			{Rate: &RateConfiguration{Unit: "records"}},
+		}}
+	if validateConfiguration(&c) == nil {
+		t.Error("the rate unit is not supported")
+	}
+	c.Producers[0].Rate = &RateConfiguration{Profile: "random"}
+	if validateConfiguration(&c) == nil {
+		t.Error("the rate profile is not supported")
+	}
+	c.Producers[0].Rate = &RateConfiguration{Unit: Bytes, Profile: Sine, Min: 100, Max: 1000, Period: "24h"}
+	if validateConfiguration(&c) != nil {
+		t.Error("expected a valid configuration")
+	}
+}
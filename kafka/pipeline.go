@@ -0,0 +1,213 @@
+package kafka
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// default size of the queue between the workers and the kafka client
+const DefaultQueueSize = 1000
+
+// generate the value and the key of the record at the index
+type RecordGenerator func(index int64) ([]byte, string, error)
+
+type PipelineConfiguration struct {
+	Name       string
+	Topic      string
+	StartIndex int64
+	Count      int
+	// max number of records generated and not yet sent
+	QueueSize int
+	// interval between the logs of the metrics, disabled if 0
+	MetricsInterval time.Duration
+	// paces the records sent, unlimited if nil
+	Rate *RateLimiter
+}
+
+// metrics of a pipeline, the time spent waiting on the queue
+// shows whether the generation or the broker is the bottleneck
+type PipelineMetrics struct {
+	Workers int
+	Sent    int64
+	Elapsed time.Duration
+	// time spent generating the records, summed over the workers
+	Generating time.Duration
+	// time the workers waited for room in the full queue, summed over the workers
+	QueueFull time.Duration
+	// time waited for the workers to generate the next record
+	QueueEmpty time.Duration
+	// time waited for the kafka client to accept the records
+	Sending time.Duration
+	// time waited to respect the rate
+	Throttled time.Duration
+	// records in the queue when the metrics were taken
+	QueueLen int
+	QueueCap int
+}
+
+type generatedRecord struct {
+	value []byte
+	key   string
+	err   error
+}
+
+type pipelineCounters struct {
+	sent       int64
+	generating int64
+	queueFull  int64
+	queueEmpty int64
+	sending    int64
+	throttled  int64
+}
+
+// generate the records with a worker per generator and send them to
+// the producer in order of index. Each worker generates the indexes
+// congruent to its position modulo the number of workers and pushes
+// them into its own queue, the queues are bounded so that the workers
+// stop when the kafka client can't keep up
+func RunPipeline(config PipelineConfiguration, generators []RecordGenerator, producer Producer) (PipelineMetrics, error) {
+	workers := len(generators)
+	queueSize := config.QueueSize
+	if queueSize == 0 {
+		queueSize = DefaultQueueSize
+	}
+	// the queue is split among the workers
+	workerQueueSize := queueSize / workers
+	if workerQueueSize == 0 {
+		workerQueueSize = 1
+	}
+	queues := make([]chan generatedRecord, workers)
+	for w := range queues {
+		queues[w] = make(chan generatedRecord, workerQueueSize)
+	}
+	var counters pipelineCounters
+	start := time.Now()
+	snapshot := func() PipelineMetrics {
+		queueLen := 0
+		for _, q := range queues {
+			queueLen += len(q)
+		}
+		return PipelineMetrics{
+			Workers:    workers,
+			Sent:       atomic.LoadInt64(&counters.sent),
+			Elapsed:    time.Since(start),
+			Generating: time.Duration(atomic.LoadInt64(&counters.generating)),
+			QueueFull:  time.Duration(atomic.LoadInt64(&counters.queueFull)),
+			QueueEmpty: time.Duration(atomic.LoadInt64(&counters.queueEmpty)),
+			Sending:    time.Duration(atomic.LoadInt64(&counters.sending)),
+			Throttled:  time.Duration(atomic.LoadInt64(&counters.throttled)),
+			QueueLen:   queueLen,
+			QueueCap:   workerQueueSize * workers,
+		}
+	}
+
+	// stop the workers when the pipeline fails
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for w, generate := range generators {
+		wg.Add(1)
+		go func(w int, generate RecordGenerator) {
+			defer wg.Done()
+			for i := w; i < config.Count; i += workers {
+				begin := time.Now()
+				value, key, err := generate(config.StartIndex + int64(i))
+				atomic.AddInt64(&counters.generating, int64(time.Since(begin)))
+				record := generatedRecord{value: value, key: key, err: err}
+				select {
+				case queues[w] <- record:
+				default:
+					// the queue is full
+					begin = time.Now()
+					select {
+					case queues[w] <- record:
+					case <-done:
+						return
+					}
+					atomic.AddInt64(&counters.queueFull, int64(time.Since(begin)))
+				}
+				if err != nil {
+					return
+				}
+			}
+		}(w, generate)
+	}
+
+	if config.MetricsInterval > 0 {
+		ticker := time.NewTicker(config.MetricsInterval)
+		defer ticker.Stop()
+		go func() {
+			for {
+				select {
+				case <-ticker.C:
+					log.Printf("Producer %s: %s", config.Name, snapshot())
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	var err error
+	for i := 0; i < config.Count; i++ {
+		queue := queues[i%workers]
+		var record generatedRecord
+		select {
+		case record = <-queue:
+		default:
+			// the queue is empty
+			begin := time.Now()
+			record = <-queue
+			atomic.AddInt64(&counters.queueEmpty, int64(time.Since(begin)))
+		}
+		if record.err != nil {
+			err = fmt.Errorf("unable to generate the record %d, %s", config.StartIndex+int64(i), record.err.Error())
+			break
+		}
+		if config.Rate != nil {
+			atomic.AddInt64(&counters.throttled, int64(config.Rate.Wait(record.key, record.value)))
+		}
+		begin := time.Now()
+		producer.ProduceAsync(record.key, record.value, config.Topic)
+		atomic.AddInt64(&counters.sending, int64(time.Since(begin)))
+		atomic.AddInt64(&counters.sent, 1)
+	}
+	close(done)
+	wg.Wait()
+	return snapshot(), err
+}
+
+// return the stage of the pipeline that limits the throughput:
+// the rate or the broker if the workers wait for room in the queue,
+// the generation if the records are sent as soon as generated
+func (m PipelineMetrics) Bottleneck() string {
+	if m.QueueFull/time.Duration(m.Workers) <= m.QueueEmpty {
+		return "generation"
+	}
+	if m.Throttled > m.Sending {
+		return "rate"
+	}
+	return "broker"
+}
+
+func (m PipelineMetrics) String() string {
+	rate := 0.0
+	if m.Elapsed > 0 {
+		rate = float64(m.Sent) / m.Elapsed.Seconds()
+	}
+	// share of the elapsed time spent in each stage,
+	// the worker stages are averaged over the workers
+	share := func(d time.Duration, workers int) float64 {
+		if m.Elapsed == 0 {
+			return 0
+		}
+		return 100 * d.Seconds() / m.Elapsed.Seconds() / float64(workers)
+	}
+	return fmt.Sprintf("%d records sent (%.0f/s), workers: %d generating %.0f%% waiting on full queue %.0f%%, sender: waiting on empty queue %.0f%% waiting on kafka %.0f%% throttled %.0f%%, queue %d/%d, bottleneck: %s",
+		m.Sent, rate,
+		m.Workers, share(m.Generating, m.Workers), share(m.QueueFull, m.Workers),
+		share(m.QueueEmpty, 1), share(m.Sending, 1), share(m.Throttled, 1),
+		m.QueueLen, m.QueueCap, m.Bottleneck())
+}
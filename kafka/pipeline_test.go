@@ -0,0 +1,108 @@
+package kafka
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	c "github.com/andrewinci/rap/configuration"
+)
+
+type testProducer struct {
+	lock  sync.Mutex
+	keys  []string
+	delay time.Duration
+}
+
+func (p *testProducer) ProduceAsync(key string, value []byte, topicName string) {
+	time.Sleep(p.delay)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.keys = append(p.keys, key)
+}
+
+func (p *testProducer) Close()               {}
+func (p *testProducer) GetErrorsCount() int  { return 0 }
+func (p *testProducer) GetSuccessCount() int { return len(p.keys) }
+
+func testGenerators(workers int, delay time.Duration) []RecordGenerator {
+	var res []RecordGenerator
+	for w := 0; w < workers; w++ {
+		res = append(res, func(index int64) ([]byte, string, error) {
+			time.Sleep(delay)
+			return []byte{byte(index)}, fmt.Sprintf("%d", index), nil
+		})
+	}
+	return res
+}
+
+func TestPipelineSendsTheRecordsInOrder(t *testing.T) {
+	producer := &testProducer{}
+	metrics, err := RunPipeline(PipelineConfiguration{StartIndex: 10, Count: 100, QueueSize: 8}, testGenerators(4, 0), producer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Sent != 100 || len(producer.keys) != 100 {
+		t.Fatalf("expected 100 records, got %d", len(producer.keys))
+	}
+	for i, k := range producer.keys {
+		if k != fmt.Sprintf("%d", i+10) {
+			t.Fatalf("expected the record %d, got %s", i+10, k)
+		}
+	}
+	if metrics.QueueCap != 8 {
+		t.Errorf("the queue should be split among the workers, got %d", metrics.QueueCap)
+	}
+}
+
+func TestPipelineStopsOnErrors(t *testing.T) {
+	producer := &testProducer{}
+	generators := testGenerators(3, 0)
+	generators[1] = func(index int64) ([]byte, string, error) {
+		if index == 7 {
+			return nil, "", fmt.Errorf("invalid record")
+		}
+		return nil, fmt.Sprintf("%d", index), nil
+	}
+	metrics, err := RunPipeline(PipelineConfiguration{Count: 1000, QueueSize: 3}, generators, producer)
+	if err == nil || err.Error() != "unable to generate the record 7, invalid record" {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if metrics.Sent != 7 || strings.Join(producer.keys, ",") != "0,1,2,3,4,5,6" {
+		t.Errorf("the records preceding the error should be sent, got %v", producer.keys)
+	}
+}
+
+func TestPipelineBottleneck(t *testing.T) {
+	config := PipelineConfiguration{Count: 40, QueueSize: 4}
+	// slow broker
+	metrics, err := RunPipeline(config, testGenerators(2, 0), &testProducer{delay: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Bottleneck() != "broker" {
+		t.Errorf("expected the broker to be the bottleneck, %s", metrics)
+	}
+	// slow generation
+	metrics, err = RunPipeline(config, testGenerators(2, time.Millisecond), &testProducer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Bottleneck() != "generation" {
+		t.Errorf("expected the generation to be the bottleneck, %s", metrics)
+	}
+	// rate limit
+	config.Rate, err = NewRateLimiter(c.RateConfiguration{Rate: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics, err = RunPipeline(config, testGenerators(2, 0), &testProducer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metrics.Bottleneck() != "rate" {
+		t.Errorf("expected the rate to be the bottleneck, %s", metrics)
+	}
+}
@@ -0,0 +1,175 @@
+package kafka
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	c "github.com/andrewinci/rap/configuration"
+)
+
+// max time the limiter sleeps before checking the rate again,
+// so that the changes of the profile are followed
+const rateCheckInterval = 100 * time.Millisecond
+
+// rate at the time elapsed since the beginning of the run
+type rateProfile func(elapsed time.Duration) float64
+
+// paces the records accordingly to a rate that changes over time.
+// The unused rate is accumulated up to rateCheckInterval
+type RateLimiter struct {
+	profile rateProfile
+	bytes   bool
+	start   time.Time
+	last    time.Time
+	tokens  float64
+	now     func() time.Time
+	sleep   func(time.Duration)
+}
+
+func NewRateLimiter(config c.RateConfiguration) (*RateLimiter, error) {
+	profile, err := newRateProfile(config)
+	if err != nil {
+		return nil, err
+	}
+	return &RateLimiter{
+		profile: profile,
+		bytes:   config.Unit == c.Bytes,
+		now:     time.Now,
+		sleep:   time.Sleep,
+	}, nil
+}
+
+// wait until the record can be sent, return the time waited
+func (l *RateLimiter) Wait(key string, value []byte) time.Duration {
+	cost := 1.0
+	if l.bytes {
+		cost = float64(len(key) + len(value))
+	}
+	begin := l.now()
+	if l.start.IsZero() {
+		l.start, l.last = begin, begin
+	}
+	for {
+		now := l.now()
+		rate := l.profile(now.Sub(l.start))
+		l.tokens += rate * now.Sub(l.last).Seconds()
+		l.last = now
+		// the records larger than the accumulated
+		// rate are sent once the tokens cover them
+		limit := math.Max(rate*rateCheckInterval.Seconds(), cost)
+		if l.tokens > limit {
+			l.tokens = limit
+		}
+		if l.tokens >= cost {
+			l.tokens -= cost
+			return now.Sub(begin)
+		}
+		wait := rateCheckInterval
+		if rate > 0 {
+			if missing := time.Duration((cost - l.tokens) / rate * float64(time.Second)); missing < wait {
+				wait = missing
+			}
+		}
+		l.sleep(wait)
+	}
+}
+
+func newRateProfile(config c.RateConfiguration) (rateProfile, error) {
+	parse := func(name string, raw string) (time.Duration, error) {
+		d, err := time.ParseDuration(raw)
+		if err != nil || d <= 0 {
+			return 0, fmt.Errorf("invalid %s `%s` of the rate, expected a positive duration e.g. 10m", name, raw)
+		}
+		return d, nil
+	}
+	for _, r := range []float64{config.Rate, config.From, config.To, config.Min, config.Max, config.BurstRate} {
+		if r < 0 {
+			return nil, fmt.Errorf("the rates must not be negative")
+		}
+	}
+	switch config.Profile {
+	case "", c.Constant:
+		if config.Rate == 0 {
+			return nil, fmt.Errorf("the constant rate requires the `rate`")
+		}
+		return func(time.Duration) float64 { return config.Rate }, nil
+	case c.Ramp:
+		if config.To == 0 {
+			return nil, fmt.Errorf("the ramp rate requires the final rate `to`")
+		}
+		duration, err := parse("duration", config.Duration)
+		if err != nil {
+			return nil, err
+		}
+		return func(elapsed time.Duration) float64 {
+			if elapsed >= duration {
+				return config.To
+			}
+			return config.From + (config.To-config.From)*elapsed.Seconds()/duration.Seconds()
+		}, nil
+	case c.Step:
+		if len(config.Steps) == 0 {
+			return nil, fmt.Errorf("the step rate requires at least one step")
+		}
+		// end of each step since the beginning of the run
+		ends := make([]time.Duration, len(config.Steps))
+		var end time.Duration
+		for i, s := range config.Steps {
+			if s.Rate < 0 {
+				return nil, fmt.Errorf("the rates must not be negative")
+			}
+			d, err := parse("step duration", s.Duration)
+			if err != nil {
+				return nil, err
+			}
+			end += d
+			ends[i] = end
+		}
+		if config.Steps[len(config.Steps)-1].Rate == 0 {
+			return nil, fmt.Errorf("the rate of the last step must be positive")
+		}
+		return func(elapsed time.Duration) float64 {
+			for i, e := range ends {
+				if elapsed < e {
+					return config.Steps[i].Rate
+				}
+			}
+			return config.Steps[len(config.Steps)-1].Rate
+		}, nil
+	case c.Sine:
+		period, err := parse("period", config.Period)
+		if err != nil {
+			return nil, err
+		}
+		if config.Max == 0 || config.Max < config.Min {
+			return nil, fmt.Errorf("the max rate of the sine must be positive and greater than or equal to the min rate")
+		}
+		return func(elapsed time.Duration) float64 {
+			phase := 2 * math.Pi * elapsed.Seconds() / period.Seconds()
+			return config.Min + (config.Max-config.Min)*(1-math.Cos(phase))/2
+		}, nil
+	case c.Burst:
+		if config.BurstRate == 0 {
+			return nil, fmt.Errorf("the burst rate requires the `burstRate`")
+		}
+		period, err := parse("period", config.Period)
+		if err != nil {
+			return nil, err
+		}
+		duration, err := parse("duration", config.Duration)
+		if err != nil {
+			return nil, err
+		}
+		if duration > period {
+			return nil, fmt.Errorf("the duration of the bursts must not exceed the period")
+		}
+		return func(elapsed time.Duration) float64 {
+			if elapsed%period < duration {
+				return config.BurstRate
+			}
+			return config.Rate
+		}, nil
+	}
+	return nil, fmt.Errorf("rate profile `%s` not supported", config.Profile)
+}
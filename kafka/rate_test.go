@@ -0,0 +1,110 @@
+package kafka
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	c "github.com/andrewinci/rap/configuration"
+)
+
+func TestRateProfiles(t *testing.T) {
+	for name, test := range map[string]struct {
+		config   c.RateConfiguration
+		expected map[time.Duration]float64
+	}{
+		"constant": {
+			config:   c.RateConfiguration{Rate: 10},
+			expected: map[time.Duration]float64{0: 10, time.Hour: 10},
+		},
+		"ramp": {
+			config:   c.RateConfiguration{Profile: c.Ramp, From: 10, To: 110, Duration: "10m"},
+			expected: map[time.Duration]float64{0: 10, 5 * time.Minute: 60, 10 * time.Minute: 110, time.Hour: 110},
+		},
+		"step": {
+			config:   c.RateConfiguration{Profile: c.Step, Steps: []c.RateStep{{Rate: 10, Duration: "1m"}, {Rate: 0, Duration: "1m"}, {Rate: 30, Duration: "1m"}}},
+			expected: map[time.Duration]float64{0: 10, 90 * time.Second: 0, 150 * time.Second: 30, time.Hour: 30},
+		},
+		"sine": {
+			config:   c.RateConfiguration{Profile: c.Sine, Min: 10, Max: 30, Period: "24h"},
+			expected: map[time.Duration]float64{0: 10, 6 * time.Hour: 20, 12 * time.Hour: 30, 24 * time.Hour: 10},
+		},
+		"burst": {
+			config:   c.RateConfiguration{Profile: c.Burst, Rate: 10, BurstRate: 100, Period: "1m", Duration: "10s"},
+			expected: map[time.Duration]float64{0: 100, 30 * time.Second: 10, 65 * time.Second: 100, 75 * time.Second: 10},
+		},
+	} {
+		profile, err := newRateProfile(test.config)
+		if err != nil {
+			t.Fatalf("%s: %s", name, err.Error())
+		}
+		for elapsed, expected := range test.expected {
+			if actual := profile(elapsed); math.Abs(actual-expected) > 1e-9 {
+				t.Errorf("%s: expected the rate %f after %s, got %f", name, expected, elapsed, actual)
+			}
+		}
+	}
+}
+
+func TestInvalidRateProfiles(t *testing.T) {
+	for expected, config := range map[string]c.RateConfiguration{
+		"the constant rate requires the `rate`":                                               {},
+		"the rates must not be negative":                                                      {Rate: -1},
+		"invalid duration `ten` of the rate, expected a positive duration e.g. 10m":           {Profile: c.Ramp, To: 10, Duration: "ten"},
+		"the step rate requires at least one step":                                            {Profile: c.Step},
+		"the rate of the last step must be positive":                                          {Profile: c.Step, Steps: []c.RateStep{{Rate: 0, Duration: "1m"}}},
+		"the max rate of the sine must be positive and greater than or equal to the min rate": {Profile: c.Sine, Min: 10, Max: 5, Period: "1h"},
+		"the duration of the bursts must not exceed the period":                               {Profile: c.Burst, BurstRate: 10, Period: "1m", Duration: "2m"},
+	} {
+		_, err := newRateProfile(config)
+		if err == nil || err.Error() != expected {
+			t.Errorf("expected the error `%s`, got `%v`", expected, err)
+		}
+	}
+}
+
+// rate limiter with a simulated clock
+func testRateLimiter(t *testing.T, config c.RateConfiguration) (*RateLimiter, *time.Time) {
+	limiter, err := NewRateLimiter(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(d time.Duration) { now = now.Add(d) }
+	return limiter, &now
+}
+
+func TestRateLimiter(t *testing.T) {
+	limiter, now := testRateLimiter(t, c.RateConfiguration{Rate: 100})
+	start := *now
+	for i := 0; i < 1000; i++ {
+		limiter.Wait("key", nil)
+	}
+	if elapsed := now.Sub(start); elapsed < 9900*time.Millisecond || elapsed > 10*time.Second {
+		t.Errorf("1000 messages at 100/s should take 10s, took %s", elapsed)
+	}
+
+	limiter, now = testRateLimiter(t, c.RateConfiguration{Unit: c.Bytes, Rate: 1000})
+	start = *now
+	for i := 0; i < 100; i++ {
+		limiter.Wait("key", make([]byte, 97))
+	}
+	if elapsed := now.Sub(start); elapsed < 9900*time.Millisecond || elapsed > 10*time.Second {
+		t.Errorf("10000 bytes at 1000/s should take 10s, took %s", elapsed)
+	}
+}
+
+func TestRateLimiterFollowsTheProfile(t *testing.T) {
+	// 1 minute at 10/s, 1 minute paused and then 100/s
+	limiter, now := testRateLimiter(t, c.RateConfiguration{Profile: c.Step, Steps: []c.RateStep{
+		{Rate: 10, Duration: "1m"}, {Rate: 0, Duration: "1m"}, {Rate: 100, Duration: "1m"},
+	}})
+	start := *now
+	for i := 0; i < 600+6000; i++ {
+		limiter.Wait("key", nil)
+	}
+	if elapsed := now.Sub(start); elapsed < 179*time.Second || elapsed > 180*time.Second {
+		t.Errorf("the messages should be sent in 3 minutes, took %s", elapsed)
+	}
+}
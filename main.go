@@ -1,8 +1,9 @@
 package main
 
 import (
+	"flag"
+	"hash/fnv"
 	"log"
-	"os"
 	"sync"
 	"time"
 
@@ -13,11 +14,19 @@ import (
 )
 
 func main() {
-	if len(os.Args) != 2 {
+	seed := flag.Int64("seed", 0, "seed of the random generators, a new seed is used at each run if not set")
+	metricsInterval := flag.Duration("metrics-interval", 10*time.Second, "interval between the logs of the producer metrics, 0 to disable")
+	flag.Parse()
+	if flag.NArg() != 1 {
 		log.Fatal("expected 1 argument with the configuration file path")
 	}
+	seedSet := false
+	flag.Visit(func(f *flag.Flag) { seedSet = seedSet || f.Name == "seed" })
+	if !seedSet {
+		*seed = time.Now().UnixMilli()
+	}
 	// load the configurations
-	configFilePath := os.Args[1]
+	configFilePath := flag.Arg(0)
 	config, err := c.LoadConfiguration(configFilePath)
 	if err != nil {
 		log.Fatal(err.Error())
@@ -47,7 +56,7 @@ func main() {
 	}
 
 	// setup all the producers and then execute
-	producers := setupProducers(*config, schemaRegistry, kafkaProducer)
+	producers := setupProducers(*config, *seed, *metricsInterval, kafkaProducer)
 
 	start := time.Now()
 	var wg sync.WaitGroup
@@ -65,36 +74,115 @@ func main() {
 		elapsed)
 }
 
-func setupProducers(config c.Configuration, schemaRegistry *registry.Client, producer k.Producer) []func(wg *sync.WaitGroup) {
+func setupProducers(config c.Configuration, seed int64, metricsInterval time.Duration, producer k.Producer) []func(wg *sync.WaitGroup) {
 	var producers []func(wg *sync.WaitGroup)
 	// setup random avro generators
-	seed := time.Now().UnixMilli() //todo: add to the arguments
 	log.Printf("Initializing the avro-generators with seed: %d", seed)
 
+	// pools shared among the producers
+	pools := ag.NewValuePools()
+	// validate all the producers before starting
+	valid := true
+	if err := ag.CheckPools(config.Producers); err != nil {
+		log.Printf("invalid value pools: %s", err.Error())
+		valid = false
+	}
 	for _, p := range config.Producers {
-		gen, err := ag.NewAvroGen(p.Avro, seed)
-		if err != nil {
-			log.Fatalf("unable to initialize the generator for the producer %s: %s", p.Name, err.Error())
+		workers := p.Workers
+		if workers == 0 {
+			workers = 1
+		}
+		// each worker needs its own generator, the records only
+		// depend on the seed and the index so the workers
+		// generate the same records of a single generator
+		producerSeed := producerSeed(seed, p)
+		var gens []ag.AvroGen
+		for w := 0; w < workers; w++ {
+			gen, err := ag.NewAvroGenWithPools(p.Avro, producerSeed, pools)
+			if err != nil {
+				log.Printf("unable to initialize the generator for the producer %s: %s", p.Name, err.Error())
+				valid = false
+				break
+			}
+			gens = append(gens, gen)
+		}
+		if len(gens) < workers {
+			closeAll(gens)
+			continue
+		}
+		if gens[0].IsSequential() && p.StartIndex > 0 {
+			log.Printf("the producer %s cannot start from the index %d, its generators depend on the previous records", p.Name, p.StartIndex)
+			closeAll(gens)
+			valid = false
+			continue
+		}
+		if gens[0].IsSequential() && workers > 1 {
+			log.Printf("the producer %s cannot use %d workers, its generators depend on the previous records", p.Name, workers)
+			closeAll(gens)
+			valid = false
+			continue
+		}
+		var rate *k.RateLimiter
+		if p.Rate != nil {
+			var err error
+			rate, err = k.NewRateLimiter(*p.Rate)
+			if err != nil {
+				log.Printf("invalid rate of the producer %s: %s", p.Name, err.Error())
+				closeAll(gens)
+				valid = false
+				continue
+			}
+		}
+		var generators []k.RecordGenerator
+		for _, gen := range gens {
+			generators = append(generators, gen.GenerateAt)
+		}
+		pipelineConfig := k.PipelineConfiguration{
+			Name:            p.Name,
+			Topic:           p.Topic,
+			StartIndex:      p.StartIndex,
+			Count:           p.NumberOfMessages,
+			QueueSize:       p.QueueSize,
+			MetricsInterval: metricsInterval,
+			Rate:            rate,
 		}
-		count := p.NumberOfMessages
-		topicName := p.Topic
-		producerName := p.Name
 		producers = append(producers, func(wg *sync.WaitGroup) {
 			defer wg.Done()
-			log.Printf("Producer %s started", producerName)
-			for i := 0; i < count; i++ {
-				msg, key, err := gen.Generate()
-				if err != nil {
-					log.Fatalf("unable to generate record")
-				}
-				producer.ProduceAsync(key, msg, topicName)
+			defer closeAll(gens)
+			log.Printf("Producer %s started with %d workers", pipelineConfig.Name, len(generators))
+			metrics, err := k.RunPipeline(pipelineConfig, generators, producer)
+			if err != nil {
+				log.Fatalf("unable to generate record for the producer %s: %s", pipelineConfig.Name, err.Error())
 			}
-			log.Printf("Producer %s completed. %d records has been produced", producerName, count)
+			log.Printf("Producer %s completed. %d records has been produced", pipelineConfig.Name, metrics.Sent)
+			log.Printf("Producer %s: %s", pipelineConfig.Name, metrics)
 		})
 	}
+	if !valid {
+		log.Fatal("invalid configuration of the producers")
+	}
 	return producers
 }
 
+// stop publishing into the value pools
+func closeAll(gens []ag.AvroGen) {
+	for _, gen := range gens {
+		gen.Close()
+	}
+}
+
+// seed of the generators of the producer, derived from the name
+// of the producer so that each producer generates different records
+func producerSeed(seed int64, p c.ProducerConfiguration) int64 {
+	if p.Seed != nil {
+		log.Printf("Initializing the avro-generator of the producer %s with seed: %d", p.Name, *p.Seed)
+		return *p.Seed
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(p.Name))
+	return seed ^ int64(hash.Sum64())
+}
+
 func buildSchemaRegistry(config c.KafkaConfiguration) *registry.Client {
 	if config.SchemaRegistry.Endpoint != "" {
 		schemaRegistry, err := registry.NewClient(config.SchemaRegistry.Endpoint)